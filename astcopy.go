@@ -0,0 +1,89 @@
+package clone
+
+import (
+	"go/ast"
+	"go/token"
+	"reflect"
+)
+
+var (
+	posType       = reflect.TypeOf(token.NoPos)
+	astObjectType = reflect.TypeOf(&ast.Object{})
+	astScopeType  = reflect.TypeOf(&ast.Scope{})
+)
+
+/*
+copyAST 位置情報と識別子の解決結果(ast.Object)を除いてASTを複製する
+replaceに含まれるノードは、型が合う場合は対応するノードに置き換える
+位置情報がないので、複製したASTはtoken.NewFileSet()で出力する
+*/
+func copyAST(node ast.Node, replace map[ast.Node]ast.Node) ast.Node {
+	if node == nil {
+		return nil
+	}
+
+	return copyValue(reflect.ValueOf(node), replace).Interface().(ast.Node)
+}
+
+func copyValue(v reflect.Value, replace map[ast.Node]ast.Node) reflect.Value {
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() || v.Type() == astObjectType || v.Type() == astScopeType {
+			return reflect.Zero(v.Type())
+		}
+
+		if node, ok := v.Interface().(ast.Node); ok {
+			if replaced, ok := replace[node]; ok {
+				return reflect.ValueOf(replaced)
+			}
+		}
+
+		copied := reflect.New(v.Type().Elem())
+		copied.Elem().Set(copyValue(v.Elem(), replace))
+
+		return copied
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		copied := reflect.New(v.Type()).Elem()
+		setValue(copied, v.Elem(), replace)
+
+		return copied
+	case reflect.Struct:
+		copied := reflect.New(v.Type()).Elem()
+		for i := 0; i < v.NumField(); i++ {
+			setValue(copied.Field(i), v.Field(i), replace)
+		}
+
+		return copied
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(v.Type())
+		}
+
+		copied := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			setValue(copied.Index(i), v.Index(i), replace)
+		}
+
+		return copied
+	}
+
+	if v.Type() == posType {
+		return reflect.Zero(posType)
+	}
+
+	return v
+}
+
+// setValue vを複製してdstに入れる(置き換えたノードの型が合わない場合は置き換えずに複製する)
+func setValue(dst, v reflect.Value, replace map[ast.Node]ast.Node) {
+	copied := copyValue(v, replace)
+	if !copied.Type().AssignableTo(dst.Type()) {
+		copied = copyValue(v, nil)
+	}
+
+	dst.Set(copied)
+}
@@ -0,0 +1,154 @@
+package baseline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// Version ベースラインファイルの形式のバージョン(互換性のない変更をしたときに上げる)
+const Version = 1
+
+var ErrUnsupportedVersion = errors.New("unsupported baseline version")
+
+/*
+Baseline 既知のクローンの一覧
+クローンは正規化されたノード列の指紋と、クローンを含むファイルの組で識別するので、
+ファイル内でコードが移動しても同じクローンとみなす
+*/
+type Baseline struct {
+	counts map[key]int
+}
+
+type key struct {
+	fingerprint string
+	file1       string
+	file2       string
+}
+
+func newKey(clonePair *clone.ClonePair) key {
+	file1, file2 := clonePair.Fragment1.Filename, clonePair.Fragment2.Filename
+	if file1 > file2 {
+		file1, file2 = file2, file1
+	}
+
+	return key{
+		fingerprint: clonePair.Fingerprint,
+		file1:       file1,
+		file2:       file2,
+	}
+}
+
+// New 現在のクローンからベースラインを作る
+func New(clonePairs []*clone.ClonePair) *Baseline {
+	counts := map[key]int{}
+	for _, clonePair := range clonePairs {
+		counts[newKey(clonePair)]++
+	}
+
+	return &Baseline{
+		counts: counts,
+	}
+}
+
+/*
+Filter ベースラインにないクローンのみを返す
+同じ指紋・ファイルの組のクローンがベースラインより増えた場合は、増えた分を新しいクローンとして返す
+*/
+func (b *Baseline) Filter(clonePairs []*clone.ClonePair) []*clone.ClonePair {
+	counts := make(map[key]int, len(b.counts))
+	for k, count := range b.counts {
+		counts[k] = count
+	}
+
+	newClonePairs := []*clone.ClonePair{}
+	for _, clonePair := range clonePairs {
+		k := newKey(clonePair)
+		if counts[k] > 0 {
+			counts[k]--
+			continue
+		}
+
+		newClonePairs = append(newClonePairs, clonePair)
+	}
+
+	return newClonePairs
+}
+
+type baselineFile struct {
+	Version int      `json:"version"`
+	Clones  []*entry `json:"clones"`
+}
+
+type entry struct {
+	Fingerprint string    `json:"fingerprint"`
+	Files       [2]string `json:"files"`
+	Count       int       `json:"count"`
+}
+
+// Write ベースラインをJSON形式で書き出す(差分が安定するよう並び替える)
+func (b *Baseline) Write(w io.Writer) error {
+	entries := make([]*entry, 0, len(b.counts))
+	for k, count := range b.counts {
+		entries = append(entries, &entry{
+			Fingerprint: k.fingerprint,
+			Files:       [2]string{k.file1, k.file2},
+			Count:       count,
+		})
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Files != entries[j].Files {
+			if entries[i].Files[0] != entries[j].Files[0] {
+				return entries[i].Files[0] < entries[j].Files[0]
+			}
+
+			return entries[i].Files[1] < entries[j].Files[1]
+		}
+
+		return entries[i].Fingerprint < entries[j].Fingerprint
+	})
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(&baselineFile{
+		Version: Version,
+		Clones:  entries,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode baseline: %w", err)
+	}
+
+	return nil
+}
+
+// Read Writeで書き出したベースラインを読み込む
+func Read(r io.Reader) (*Baseline, error) {
+	var file baselineFile
+	err := json.NewDecoder(r).Decode(&file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode baseline: %w", err)
+	}
+
+	if file.Version != Version {
+		return nil, fmt.Errorf("%w: %d", ErrUnsupportedVersion, file.Version)
+	}
+
+	counts := make(map[key]int, len(file.Clones))
+	for _, entry := range file.Clones {
+		counts[key{
+			fingerprint: entry.Fingerprint,
+			file1:       entry.Files[0],
+			file2:       entry.Files[1],
+		}] += entry.Count
+	}
+
+	return &Baseline{
+		counts: counts,
+	}, nil
+}
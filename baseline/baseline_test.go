@@ -0,0 +1,155 @@
+package baseline_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/baseline"
+)
+
+func newClonePair(fingerprint, filename1 string, line1 int, filename2 string, line2 int) *clone.ClonePair {
+	return &clone.ClonePair{
+		Fragment1: &clone.Fragment{
+			Filename:  filename1,
+			StartLine: line1,
+		},
+		Fragment2: &clone.Fragment{
+			Filename:  filename2,
+			StartLine: line2,
+		},
+		Fingerprint: fingerprint,
+	}
+}
+
+func roundTrip(t *testing.T, b *baseline.Baseline) *baseline.Baseline {
+	t.Helper()
+
+	buf := &bytes.Buffer{}
+	err := b.Write(buf)
+	if err != nil {
+		t.Fatalf("failed to write baseline: %v", err)
+	}
+
+	b, err = baseline.Read(buf)
+	if err != nil {
+		t.Fatalf("failed to read baseline: %v", err)
+	}
+
+	return b
+}
+
+func TestRoundTrip(t *testing.T) {
+	known := []*clone.ClonePair{
+		newClonePair("f1", "a.go", 3, "b.go", 5),
+		newClonePair("f1", "a.go", 10, "b.go", 12),
+		newClonePair("f2", "b.go", 7, "c.go", 7),
+	}
+
+	expected := &bytes.Buffer{}
+	err := baseline.New(known).Write(expected)
+	if err != nil {
+		t.Fatalf("failed to write baseline: %v", err)
+	}
+
+	actual := &bytes.Buffer{}
+	err = roundTrip(t, baseline.New(known)).Write(actual)
+	if err != nil {
+		t.Fatalf("failed to write baseline: %v", err)
+	}
+
+	if expected.String() != actual.String() {
+		t.Errorf("baseline changed through a round trip:\nexpected %s\nactual   %s", expected, actual)
+	}
+
+	// 読み込んだベースラインでも、同じクローンは全て既知とみなす
+	if newClonePairs := roundTrip(t, baseline.New(known)).Filter(known); len(newClonePairs) != 0 {
+		t.Errorf("known clones are reported: %d", len(newClonePairs))
+	}
+}
+
+func TestFilter(t *testing.T) {
+	known := newClonePair("f1", "a.go", 3, "b.go", 5)
+	b := roundTrip(t, baseline.New([]*clone.ClonePair{known}))
+
+	tests := []struct {
+		description string
+		clonePairs  []*clone.ClonePair
+		expected    []int
+	}{
+		{
+			description: "existing clone",
+			clonePairs:  []*clone.ClonePair{known},
+			expected:    []int{},
+		},
+		{
+			description: "moved in the same files",
+			clonePairs:  []*clone.ClonePair{newClonePair("f1", "a.go", 20, "b.go", 30)},
+			expected:    []int{},
+		},
+		{
+			description: "swapped files",
+			clonePairs:  []*clone.ClonePair{newClonePair("f1", "b.go", 5, "a.go", 3)},
+			expected:    []int{},
+		},
+		{
+			description: "new fingerprint",
+			clonePairs:  []*clone.ClonePair{known, newClonePair("f2", "a.go", 3, "b.go", 5)},
+			expected:    []int{1},
+		},
+		{
+			description: "new file",
+			clonePairs:  []*clone.ClonePair{newClonePair("f1", "a.go", 3, "c.go", 5)},
+			expected:    []int{0},
+		},
+		{
+			description: "more clones than known",
+			clonePairs:  []*clone.ClonePair{known, newClonePair("f1", "a.go", 40, "b.go", 50)},
+			expected:    []int{1},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			expected := make([]*clone.ClonePair, 0, len(test.expected))
+			for _, i := range test.expected {
+				expected = append(expected, test.clonePairs[i])
+			}
+
+			actual := b.Filter(test.clonePairs)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("unexpected new clones: expected %d, actual %d", len(expected), len(actual))
+			}
+		})
+	}
+}
+
+func TestReadUnsupportedVersion(t *testing.T) {
+	tests := []struct {
+		description string
+		src         string
+	}{
+		{
+			description: "newer version",
+			src:         `{"version": 2, "clones": []}`,
+		},
+		{
+			description: "no version",
+			src:         `{"clones": []}`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			_, err := baseline.Read(strings.NewReader(test.src))
+			if !errors.Is(err, baseline.ErrUnsupportedVersion) {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
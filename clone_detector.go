@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"go/ast"
+	"go/token"
+	"sort"
 
 	"github.com/mazrean/go-clone-detection/domain"
 	"github.com/mazrean/go-clone-detection/serializer"
@@ -14,17 +16,32 @@ import (
 
 type CloneDetector struct {
 	config     *Config
+	fset       *token.FileSet
 	serializer Serializer
 	suffixTree SuffixTree
+	// ファイル名から、そのファイルのASTを追加した接尾辞木の入力のインデックスへの対応
+	// (同じファイルの複数の部分木を別々に追加した場合は、追加した順に複数の入力になる)
+	files map[string][]int
+	// 接尾辞木の入力から、その入力のASTを含むファイルへの対応
+	tokenFiles map[int]*token.File
+	// ファイル全体を追加した場合の、ファイルからそのASTへの対応(クローンを含む関数を探すのに使う)
+	astFiles map[*token.File]*ast.File
 }
 
 func NewCloneDetector(config *Config) *CloneDetector {
 	if config == nil {
 		config = DefaultConfig
 	}
+	// DefaultConfigなどを複数のCloneDetectorで共有しても状態が混ざらないようにコピーする
+	copiedConfig := *config
+	config = &copiedConfig
+
+	if config.FileSet == nil {
+		config.FileSet = token.NewFileSet()
+	}
 
 	if config.Serializer == nil {
-		config.Serializer = &serializer.Serializer{}
+		config.Serializer = serializer.NewSerializer(config.MatchMode)
 	}
 
 	if config.SuffixTree == nil {
@@ -33,11 +50,21 @@ func NewCloneDetector(config *Config) *CloneDetector {
 
 	return &CloneDetector{
 		config:     config,
+		fset:       config.FileSet,
 		serializer: config.Serializer,
 		suffixTree: config.SuffixTree,
+		files:      map[string][]int{},
+		tokenFiles: map[int]*token.File{},
+		astFiles:   map[*token.File]*ast.File{},
 	}
 }
 
+// FileSet 位置情報の解決に使うFileSet
+// AddNodeに渡すASTはこのFileSetでパースしたものである必要がある
+func (cd *CloneDetector) FileSet() *token.FileSet {
+	return cd.fset
+}
+
 func (cd *CloneDetector) AddNode(ctx context.Context, root ast.Node) error {
 	nodeChan := make(chan *domain.Node)
 
@@ -45,6 +72,11 @@ func (cd *CloneDetector) AddNode(ctx context.Context, root ast.Node) error {
 		return errors.New("root node is nil")
 	}
 
+	err := cd.checkRoot(root)
+	if err != nil {
+		return err
+	}
+
 	eg, ctx := errgroup.WithContext(ctx)
 	eg.Go(func() error {
 		defer close(nodeChan)
@@ -75,45 +107,517 @@ func (cd *CloneDetector) AddNode(ctx context.Context, root ast.Node) error {
 		}
 	})
 
-	err := eg.Wait()
+	err = eg.Wait()
 	if err != nil {
 		return err
 	}
 
+	return cd.closeDocument(root)
+}
+
+// closeDocument rootのノードを全て追加した入力を終端し、rootを含むファイルと対応付ける
+func (cd *CloneDetector) closeDocument(root ast.Node) error {
+	document, err := cd.suffixTree.CloseDocument()
+	if err != nil {
+		return fmt.Errorf("suffix tree error: %w", err)
+	}
+
+	if filename := cd.fset.Position(root.Pos()).Filename; filename != "" {
+		cd.files[filename] = append(cd.files[filename], document)
+		cd.tokenFiles[document] = cd.fset.File(root.Pos())
+
+		if file, ok := root.(*ast.File); ok {
+			cd.astFiles[cd.tokenFiles[document]] = file
+		}
+	}
+
+	return nil
+}
+
+var (
+	ErrFileNotFound = errors.New("file not found")
+	ErrFileRequired = errors.New("statement sequence granularity requires whole files to be added")
+)
+
+/*
+checkRoot rootを追加できるか確かめる
+文の並びは親のブロック文などから求めるので、GranularityStatementSequenceではファイル全体(*ast.File)しか追加できない
+*/
+func (cd *CloneDetector) checkRoot(root ast.Node) error {
+	if _, ok := root.(*ast.File); !ok && cd.config.Granularity == GranularityStatementSequence {
+		return fmt.Errorf("%w: %T", ErrFileRequired, root)
+	}
+
 	return nil
 }
 
+// RemoveFile AddNodeで追加したファイルを以降のクローン検出の対象から外す(ファイル内の部分木を別々に追加した場合は全て外す)
+func (cd *CloneDetector) RemoveFile(filename string) error {
+	documents, ok := cd.files[filename]
+	if !ok {
+		return ErrFileNotFound
+	}
+
+	for i, document := range documents {
+		err := cd.suffixTree.RemoveDocument(document)
+		if err != nil {
+			// 外せた入力は対応から除き、残りを再び外せるようにする
+			cd.files[filename] = documents[i:]
+			return fmt.Errorf("suffix tree error: %w", err)
+		}
+
+		delete(cd.astFiles, cd.tokenFiles[document])
+		delete(cd.tokenFiles, document)
+	}
+
+	delete(cd.files, filename)
+
+	return nil
+}
+
+// ReplaceFile rootと同じファイル名で追加済みのファイルがあれば削除し、rootを追加する
+func (cd *CloneDetector) ReplaceFile(ctx context.Context, root ast.Node) error {
+	if root == nil {
+		return errors.New("root node is nil")
+	}
+
+	filename := cd.fset.Position(root.Pos()).Filename
+	if filename == "" {
+		return errors.New("root node is not in the file set")
+	}
+
+	// 削除した後で追加できずにファイルが失われないよう、先に確かめる
+	err := cd.checkRoot(root)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := cd.files[filename]; ok {
+		err = cd.RemoveFile(filename)
+		if err != nil {
+			return err
+		}
+	}
+
+	return cd.AddNode(ctx, root)
+}
+
 type ClonePair struct {
-	Node1 ast.Node
-	Node2 ast.Node
+	// 単一の部分木からなるクローンの場合のみ設定される(それ以外はFragmentのNodesを使う)
+	Node1     ast.Node
+	Node2     ast.Node
+	Fragment1 *Fragment
+	Fragment2 *Fragment
+	// 正規化されたノード列のハッシュ(位置に依存しない)
+	Fingerprint string
+	Type        CloneType
+	// 一致したノード数の割合(ギャップのないクローンは1)
+	Similarity float64
 }
 
+// GetClones クローンを1つ目のコード片(ファイル名、位置の順)、2つ目のコード片、ノード数の順に並べて返す
 func (cd *CloneDetector) GetClones() ([]*ClonePair, error) {
-	cloneSequencePairs, err := cd.suffixTree.GetClonePairs(cd.config.Threshold)
+	return cd.getClones(cd.config.ParameterizedMatch)
+}
+
+func (cd *CloneDetector) getClones(parameterizedMatch bool) ([]*ClonePair, error) {
+	clonePairs := []*ClonePair{}
+	err := cd.eachClone(context.Background(), parameterizedMatch, func(clonePair *ClonePair) error {
+		clonePairs = append(clonePairs, clonePair)
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("suffix tree error: %w", err)
+		return nil, err
 	}
 
-	clonePairs := []*ClonePair{}
-	for _, cloneSequencePair := range cloneSequencePairs {
+	sortClonePairs(clonePairs)
+
+	return clonePairs, nil
+}
+
+/*
+EachClone GetClonesと同じクローンを、接尾辞木を辿りながら見つけた順にyieldへ渡す
+全てのクローンを一度に持たないので、大きな入力でもメモリ使用量が増えない
+yieldがエラーを返すかctxがキャンセルされた場合は、そこで中断してそのエラーを返す
+MaxGapを指定した場合、ギャップのあるクローンは全ての完全一致のクローンの後に渡す
+(結合のために完全一致のクローンの組を全て保持するので、メモリ使用量は抑えられない)
+渡す順は毎回同じになるが、GetClonesのようには並ばない
+*/
+func (cd *CloneDetector) EachClone(ctx context.Context, yield func(*ClonePair) error) error {
+	return cd.eachClone(ctx, cd.config.ParameterizedMatch, yield)
+}
+
+func (cd *CloneDetector) eachClone(ctx context.Context, parameterizedMatch bool, yield func(*ClonePair) error) error {
+	// ギャップのあるクローンは入力の組ごとにまとめて結合するので、ノード列の組だけは保持する
+	var cloneSequencePairs []*domain.CloneSequencePair
+	// yieldやキャンセルによるエラーは、接尾辞木のエラーとして包まずにそのまま返す
+	var yieldErr error
+	positions := cd.newStatementPositions()
+	err := cd.suffixTree.EachClonePair(ctx, cd.config.Threshold, func(cloneSequencePair *domain.CloneSequencePair) error {
+		if cd.config.MaxGap > 0 {
+			cloneSequencePairs = append(cloneSequencePairs, cloneSequencePair)
+		}
+
 		sequence1, sequence2 := cloneSequencePair.GetNodes()
-		var i int64
-		for i = 0; i < int64(cloneSequencePair.GetLength()); {
-			node1 := sequence1[i]
-
-			if int64(node1.GetChildCount()) <= int64(len(sequence1)) {
-				if int(node1.GetChildCount()) > cd.config.Threshold {
-					clonePairs = append(clonePairs, &ClonePair{
-						node1.GetNode(),
-						sequence2[i].GetNode(),
-					})
+
+		// 連続して並ぶ文は1つのクローンにまとめ、含まれる文は個別に報告しない
+		var sequenceClonePairs []*ClonePair
+		covered := map[int]struct{}{}
+		if cd.config.Granularity == GranularityStatementSequence {
+			for _, run := range cd.statementRuns([][]*domain.Node{sequence1, sequence2}, positions) {
+				clonePair := cd.newStatementSequenceClonePair(sequence1, sequence2, run)
+				if parameterizedMatch && !isParameterizedMatch(clonePair.Fragment1.Nodes, clonePair.Fragment2.Nodes) {
+					continue
+				}
+
+				sequenceClonePairs = append(sequenceClonePairs, clonePair)
+				for _, i := range run {
+					covered[i] = struct{}{}
 				}
-				i += int64(node1.GetChildCount()) + 1
-			} else {
-				i++
 			}
 		}
+
+		for _, i := range splitSubtrees(sequence1, cd.config.Threshold, cd.areUnits([][]*domain.Node{sequence1, sequence2})) {
+			if _, ok := covered[i]; ok {
+				continue
+			}
+
+			node1, node2 := sequence1[i].GetNode(), sequence2[i].GetNode()
+			if parameterizedMatch && !isParameterizedMatch([]ast.Node{node1}, []ast.Node{node2}) {
+				continue
+			}
+
+			clonePair := &ClonePair{
+				Node1:       node1,
+				Node2:       node2,
+				Fragment1:   newFragment(cd.fset, sequence1[i]),
+				Fragment2:   newFragment(cd.fset, sequence2[i]),
+				Fingerprint: fingerprint(subtree(sequence1, i)),
+				Type:        classifyCloneType([]ast.Node{node1}, []ast.Node{node2}),
+				Similarity:  1,
+			}
+			clonePair.orient()
+
+			err := yield(clonePair)
+			if err != nil {
+				yieldErr = err
+				return err
+			}
+		}
+
+		for _, clonePair := range sequenceClonePairs {
+			clonePair.orient()
+
+			err := yield(clonePair)
+			if err != nil {
+				yieldErr = err
+				return err
+			}
+		}
+
+		return nil
+	})
+	if yieldErr != nil {
+		return yieldErr
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err != nil {
+		return fmt.Errorf("suffix tree error: %w", err)
 	}
 
-	return clonePairs, nil
+	if cd.config.MaxGap > 0 {
+		for _, gappedClone := range mergeGappedClones(cloneSequencePairs, cd.config.MaxGap) {
+			err := ctx.Err()
+			if err != nil {
+				return err
+			}
+
+			// 粒度を指定した場合は、単位になる部分木全体を覆うものだけを、その部分木のクローンとして報告する
+			var root1, root2 *domain.Node
+			if cd.config.Granularity != GranularityAny {
+				root1, root2, err = cd.gappedUnits(ctx, gappedClone)
+				if err != nil {
+					return err
+				}
+				if root1 == nil {
+					continue
+				}
+			}
+
+			clonePair := cd.newGappedClonePair(gappedClone)
+			if parameterizedMatch && !isParameterizedMatch(clonePair.Fragment1.Nodes, clonePair.Fragment2.Nodes) {
+				continue
+			}
+
+			if root1 != nil {
+				clonePair.Node1, clonePair.Node2 = root1.GetNode(), root2.GetNode()
+				clonePair.Fragment1, clonePair.Fragment2 = newFragment(cd.fset, root1), newFragment(cd.fset, root2)
+				clonePair.Similarity = float64(2*gappedClone.matchedLength()) / float64(clonePair.Fragment1.TokenCount+clonePair.Fragment2.TokenCount)
+			}
+
+			clonePair.orient()
+
+			err = yield(clonePair)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// CloneClass 互いにクローンとなっているコード片の集合
+type CloneClass struct {
+	// 各コード片が単一の部分木からなる場合はその根(連続して並ぶ文をまとめたものなどはnilになり、FragmentのNodesを使う)
+	Nodes     []ast.Node
+	Fragments []*Fragment
+	// 各コード片に含まれるASTノード数
+	TokenCount int
+	// 正規化されたノード列のハッシュ(位置に依存しない)
+	Fingerprint string
+	// 先頭のコード片と他のコード片の間で最も差の大きいクローンの種類
+	Type CloneType
+}
+
+// GetCloneClasses クローンクラスを先頭のコード片(ファイル名、位置の順)、ノード数の順に並べて返す
+func (cd *CloneDetector) GetCloneClasses() ([]*CloneClass, error) {
+	domainCloneClasses, err := cd.suffixTree.GetCloneClasses(cd.config.Threshold)
+	if err != nil {
+		return nil, fmt.Errorf("suffix tree error: %w", err)
+	}
+
+	/*
+		長いクローンクラスから切り出した部分木は、より多くのコード片を持つ
+		短いクローンクラスの部分木と重複することがあるので、包含されるものは除く
+		各クラスはコード片ごとの部分木の根の並び(連続して並ぶ文をまとめたもの以外は1つ)からなる
+	*/
+	subtreeClasses := [][][]*domain.Node{}
+	tokenCounts := []int{}
+	fingerprints := []string{}
+	classMap := map[*domain.Node][]int{}
+	positions := cd.newStatementPositions()
+	for _, domainCloneClass := range domainCloneClasses {
+		sequences := domainCloneClass.GetSequences()
+		if len(sequences) < 2 {
+			continue
+		}
+
+		nodes := make([][]*domain.Node, 0, len(sequences))
+		for _, sequence := range sequences {
+			nodes = append(nodes, sequence.GetNodes())
+		}
+
+		// 連続して並ぶ文は1つのクローンクラスにまとめ、含まれる文は個別に報告しない
+		runs := [][]int{}
+		covered := map[int]struct{}{}
+		if cd.config.Granularity == GranularityStatementSequence {
+			runs = cd.statementRuns(nodes, positions)
+			for _, run := range runs {
+				for _, i := range run {
+					covered[i] = struct{}{}
+				}
+			}
+		}
+		for _, i := range splitSubtrees(nodes[0], cd.config.Threshold, cd.areUnits(nodes)) {
+			if _, ok := covered[i]; !ok {
+				runs = append(runs, []int{i})
+			}
+		}
+
+		for _, run := range runs {
+			fragments := make([][]*domain.Node, 0, len(nodes))
+			for _, sequence := range nodes {
+				roots := make([]*domain.Node, 0, len(run))
+				for _, i := range run {
+					roots = append(roots, sequence[i])
+				}
+				fragments = append(fragments, roots)
+				classMap[roots[0]] = append(classMap[roots[0]], len(subtreeClasses))
+			}
+
+			length := runLength(nodes[0], run)
+			last := run[len(run)-1]
+			subtreeClasses = append(subtreeClasses, fragments)
+			tokenCounts = append(tokenCounts, length)
+			fingerprints = append(fingerprints, fingerprint(nodes[0][last-length+1:last+1]))
+		}
+	}
+
+	cloneClasses := []*CloneClass{}
+	for i, fragments := range subtreeClasses {
+		if isCoveredClass(i, fragments, subtreeClasses, classMap) {
+			continue
+		}
+
+		groups := [][][]*domain.Node{fragments}
+		if cd.config.ParameterizedMatch {
+			groups = groupByParameterizedMatch(fragments)
+		}
+
+		for _, group := range groups {
+			cloneClasses = append(cloneClasses, cd.newCloneClass(group, tokenCounts[i], fingerprints[i]))
+		}
+	}
+
+	sortCloneClasses(cloneClasses)
+
+	return cloneClasses, nil
+}
+
+// newCloneClass コード片ごとの部分木の根の並びからクローンクラスを作る(根が1つでない場合、Nodesはnilになる)
+func (cd *CloneDetector) newCloneClass(fragments [][]*domain.Node, tokenCount int, fingerprint string) *CloneClass {
+	cloneClass := &CloneClass{
+		Nodes:       make([]ast.Node, 0, len(fragments)),
+		Fragments:   make([]*Fragment, 0, len(fragments)),
+		TokenCount:  tokenCount,
+		Fingerprint: fingerprint,
+	}
+	for _, roots := range fragments {
+		cloneClass.Fragments = append(cloneClass.Fragments, newSequenceFragment(cd.fset, roots, tokenCount))
+	}
+
+	// コード片を位置の順に並べる
+	sort.SliceStable(cloneClass.Fragments, func(i, j int) bool {
+		return compareFragments(cloneClass.Fragments[i], cloneClass.Fragments[j]) < 0
+	})
+
+	for _, fragment := range cloneClass.Fragments {
+		var node ast.Node
+		if len(fragment.Nodes) == 1 {
+			node = fragment.Nodes[0]
+		}
+		cloneClass.Nodes = append(cloneClass.Nodes, node)
+	}
+
+	for _, fragment := range cloneClass.Fragments[1:] {
+		cloneType := classifyCloneType(cloneClass.Fragments[0].Nodes, fragment.Nodes)
+		if cloneType == CloneTypeUnknown {
+			cloneClass.Type = CloneTypeUnknown
+			break
+		}
+
+		if cloneType > cloneClass.Type {
+			cloneClass.Type = cloneType
+		}
+	}
+
+	return cloneClass
+}
+
+// groupByParameterizedMatch 識別子の対応が一対一になるもの同士に分け、2つ以上のコード片を持つグループを返す
+func groupByParameterizedMatch(fragments [][]*domain.Node) [][][]*domain.Node {
+	groups := [][][]*domain.Node{}
+	for _, roots := range fragments {
+		var added bool
+		for i, group := range groups {
+			if isParameterizedMatch(rootNodes(group[0]), rootNodes(roots)) {
+				groups[i] = append(group, roots)
+				added = true
+				break
+			}
+		}
+
+		if !added {
+			groups = append(groups, [][]*domain.Node{roots})
+		}
+	}
+
+	matchedGroups := [][][]*domain.Node{}
+	for _, group := range groups {
+		if len(group) > 1 {
+			matchedGroups = append(matchedGroups, group)
+		}
+	}
+
+	return matchedGroups
+}
+
+// rootNodes 部分木の根のASTノード
+func rootNodes(roots []*domain.Node) []ast.Node {
+	nodes := make([]ast.Node, 0, len(roots))
+	for _, root := range roots {
+		nodes = append(nodes, root.GetNode())
+	}
+
+	return nodes
+}
+
+/*
+isCoveredClass i番目のクラスの全てのコード片を含む、より大きい(同じ大きさの場合はより前の)クラスがあるか
+コード片は先頭の根と根の数が同じなら同じものとみなす
+*/
+func isCoveredClass(i int, fragments [][]*domain.Node, subtreeClasses [][][]*domain.Node, classMap map[*domain.Node][]int) bool {
+	for _, j := range classMap[fragments[0][0]] {
+		if j == i ||
+			len(subtreeClasses[j][0]) != len(fragments[0]) ||
+			len(subtreeClasses[j]) < len(fragments) ||
+			(len(subtreeClasses[j]) == len(fragments) && j > i) {
+			continue
+		}
+
+		covered := true
+		for _, roots := range fragments[1:] {
+			if !containsInt(classMap[roots[0]], j) {
+				covered = false
+				break
+			}
+		}
+
+		if covered {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subtree 帰りがけ順のシーケンスのi番目のノードを根とする部分木
+func subtree(sequence []*domain.Node, i int) []*domain.Node {
+	return sequence[i-int(sequence[i].GetChildCount()) : i+1]
+}
+
+/*
+splitSubtrees シーケンス中に完全に含まれる極大な部分木のうち、子孫の数が閾値より大きいものの根の位置を返す
+acceptがnilでない場合は、acceptが真になる根の部分木だけを選び、それ以外は子の部分木を見る
+シーケンスは帰りがけ順なので、部分木の根は部分木の末尾にある
+*/
+func splitSubtrees(sequence []*domain.Node, threshold int, accept func(i int) bool) []int {
+	roots := []int{}
+	for i := len(sequence) - 1; i >= 0; {
+		childCount := int(sequence[i].GetChildCount())
+		if i-childCount < 0 {
+			// 部分木の先頭がシーケンスからはみ出している場合は子の部分木を見る
+			i--
+			continue
+		}
+
+		if childCount > threshold && accept != nil && !accept(i) {
+			i--
+			continue
+		}
+
+		if childCount > threshold {
+			roots = append(roots, i)
+		}
+		i -= childCount + 1
+	}
+
+	for i, j := 0, len(roots)-1; i < j; i, j = i+1, j-1 {
+		roots[i], roots[j] = roots[j], roots[i]
+	}
+
+	return roots
 }
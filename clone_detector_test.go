@@ -0,0 +1,455 @@
+package clone_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/sarray"
+	"github.com/mazrean/go-clone-detection/stree"
+)
+
+type source struct {
+	filename string
+	src      string
+}
+
+// newSourceDetector sourcesをパースし、順にAddNodeで追加したCloneDetectorを作る
+func newSourceDetector(t *testing.T, config clone.Config, sources ...source) *clone.CloneDetector {
+	t.Helper()
+
+	cd := clone.NewCloneDetector(&config)
+	for _, s := range sources {
+		file, err := parser.ParseFile(cd.FileSet(), s.filename, s.src, 0)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", s.filename, err)
+		}
+
+		err = cd.AddNode(context.Background(), file)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", s.filename, err)
+		}
+	}
+
+	return cd
+}
+
+func getClones(t *testing.T, cd *clone.CloneDetector) []*clone.ClonePair {
+	t.Helper()
+
+	clonePairs, err := cd.GetClones()
+	if err != nil {
+		t.Fatalf("failed to get clones: %v", err)
+	}
+
+	return clonePairs
+}
+
+// findClone 2つのコード片がそれぞれ指定した行から始まるクローンを探す
+func findClone(clonePairs []*clone.ClonePair, filename1 string, line1 int, filename2 string, line2 int) *clone.ClonePair {
+	for _, clonePair := range clonePairs {
+		if clonePair.Fragment1.Filename == filename1 && clonePair.Fragment1.StartLine == line1 &&
+			clonePair.Fragment2.Filename == filename2 && clonePair.Fragment2.StartLine == line2 {
+			return clonePair
+		}
+	}
+
+	return nil
+}
+
+const genericSource1 = `package p
+
+func Map[T, U any](values []T, f func(T) U) []U {
+	results := make([]U, 0, len(values))
+	for _, value := range values {
+		results = append(results, f(value))
+	}
+	return results
+}
+
+type Number interface {
+	~int | ~int64 | ~float64
+}
+`
+
+const genericSource2 = `package p
+
+func Convert[A, B any](items []A, convert func(A) B) []B {
+	converted := make([]B, 0, len(items))
+	for _, item := range items {
+		converted = append(converted, convert(item))
+	}
+	return converted
+}
+
+const limit = 3
+
+type Numeric interface {
+	~int | ~int64 | ~float64
+}
+`
+
+// findCloneClass 指定した位置のコード片からなるクローンクラスを探す
+func findCloneClass(t *testing.T, cd *clone.CloneDetector, fragments ...string) *clone.CloneClass {
+	t.Helper()
+
+	cloneClasses, err := cd.GetCloneClasses()
+	if err != nil {
+		t.Fatalf("failed to get clone classes: %v", err)
+	}
+
+	for _, cloneClass := range cloneClasses {
+		if len(cloneClass.Fragments) != len(fragments) {
+			continue
+		}
+
+		found := true
+		for i, fragment := range cloneClass.Fragments {
+			if fragment.String() != fragments[i] {
+				found = false
+				break
+			}
+		}
+		if found {
+			return cloneClass
+		}
+	}
+
+	return nil
+}
+
+func TestCloneClassesGenerics(t *testing.T) {
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", genericSource1},
+		source{"b.go", genericSource2},
+	)
+
+	cloneClass := findCloneClass(t, cd, "a.go:3:1-9:2", "b.go:3:1-9:2")
+	if cloneClass == nil {
+		t.Fatal("clone of generic functions not found")
+	}
+	if cloneClass.Type != clone.CloneType2 {
+		t.Errorf("unexpected clone type: %s", cloneClass.Type)
+	}
+
+	// ~Tの和からなる型制約も一致する
+	if findCloneClass(t, cd, "a.go:11:1-13:2", "b.go:13:1-15:2") == nil {
+		t.Error("clone of union constraints not found")
+	}
+}
+
+func TestCloneClassesGenericsDistinguishTypeParams(t *testing.T) {
+	// 型パラメータを持たない関数とは一致しない
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", genericSource1},
+		source{"b.go", `package p
+
+func Convert(items []int, convert func(int) string) []string {
+	converted := make([]string, 0, len(items))
+	for _, item := range items {
+		converted = append(converted, convert(item))
+	}
+	return converted
+}
+`},
+	)
+
+	if findCloneClass(t, cd, "a.go:3:1-9:2", "b.go:3:1-9:2") != nil {
+		t.Error("generic and non-generic functions are reported as a whole function clone")
+	}
+}
+
+const sumSource = `package p
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`
+
+const countSource = `package p
+
+func count(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	return n
+}
+`
+
+const joinSource = `package p
+
+func join(parts []string, sep string) string {
+	if len(parts) == 0 {
+		return ""
+	}
+	result := parts[0]
+	for _, part := range parts[1:] {
+		result += sep + part
+	}
+	return result
+}
+`
+
+// fragmentFiles クローンのコード片のファイル名の組
+func fragmentFiles(clonePairs []*clone.ClonePair) []string {
+	files := make([]string, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		files = append(files, clonePair.Fragment1.Filename+" "+clonePair.Fragment2.Filename)
+	}
+
+	return files
+}
+
+func parseSource(t *testing.T, cd *clone.CloneDetector, s source) *ast.File {
+	t.Helper()
+
+	file, err := parser.ParseFile(cd.FileSet(), s.filename, s.src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", s.filename, err)
+	}
+
+	return file
+}
+
+func TestRemoveFile(t *testing.T) {
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, SuffixTree: e.newSuffixTree()},
+				source{"a.go", sumSource},
+				source{"b.go", countSource},
+				source{"c.go", sumSource},
+			)
+			assertSameLines(t, []string{"a.go b.go", "a.go c.go", "b.go c.go"}, fragmentFiles(getClones(t, cd)))
+
+			err := cd.RemoveFile("b.go")
+			if err != nil {
+				t.Fatalf("failed to remove file: %v", err)
+			}
+			assertSameLines(t, []string{"a.go c.go"}, fragmentFiles(getClones(t, cd)))
+
+			cloneClasses, err := cd.GetCloneClasses()
+			if err != nil {
+				t.Fatalf("failed to get clone classes: %v", err)
+			}
+			if len(cloneClasses) != 1 || len(cloneClasses[0].Fragments) != 2 {
+				t.Fatalf("unexpected clone classes after removal: %v", cloneClassStrings(cloneClasses))
+			}
+
+			err = cd.RemoveFile("b.go")
+			if !errors.Is(err, clone.ErrFileNotFound) {
+				t.Errorf("unexpected error removing a removed file: %v", err)
+			}
+
+			err = cd.RemoveFile("c.go")
+			if err != nil {
+				t.Fatalf("failed to remove file: %v", err)
+			}
+			assertSameLines(t, []string{}, fragmentFiles(getClones(t, cd)))
+		})
+	}
+}
+
+func TestReplaceFile(t *testing.T) {
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, SuffixTree: e.newSuffixTree()},
+				source{"a.go", sumSource},
+				source{"b.go", countSource},
+				source{"c.go", joinSource},
+			)
+			assertSameLines(t, []string{"a.go b.go"}, fragmentFiles(getClones(t, cd)))
+
+			// b.goの内容をc.goと重複するものに変える
+			err := cd.ReplaceFile(context.Background(), parseSource(t, cd, source{"b.go", joinSource}))
+			if err != nil {
+				t.Fatalf("failed to replace file: %v", err)
+			}
+
+			clonePairs := getClones(t, cd)
+			assertSameLines(t, []string{"b.go c.go"}, fragmentFiles(clonePairs))
+			// 位置は置き換えた後のファイルで解決される
+			if clonePairs[0].Fragment1.EndLine != 12 {
+				t.Errorf("unexpected fragment of replaced file: %s", clonePairs[0].Fragment1)
+			}
+
+			// 追加されていないファイルは追加される
+			err = cd.ReplaceFile(context.Background(), parseSource(t, cd, source{"d.go", sumSource}))
+			if err != nil {
+				t.Fatalf("failed to replace file: %v", err)
+			}
+			assertSameLines(t, []string{"a.go d.go", "b.go c.go"}, fragmentFiles(getClones(t, cd)))
+		})
+	}
+}
+
+func TestRemoveFileSubtrees(t *testing.T) {
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"c.go", sumSource},
+		source{"d.go", countSource},
+	)
+
+	// 同じファイルの関数を1つずつ追加する
+	file, err := parser.ParseFile(cd.FileSet(), "a.go", sumSource+countSource[len("package p\n"):], 0)
+	if err != nil {
+		t.Fatalf("failed to parse a.go: %v", err)
+	}
+	for _, decl := range file.Decls {
+		err := cd.AddNode(context.Background(), decl)
+		if err != nil {
+			t.Fatalf("failed to add a declaration of a.go: %v", err)
+		}
+	}
+
+	var found bool
+	for _, files := range fragmentFiles(getClones(t, cd)) {
+		found = found || strings.HasPrefix(files, "a.go ")
+	}
+	if !found {
+		t.Fatal("no clones of a.go found")
+	}
+
+	// 別々に追加した全ての部分木を外す
+	err = cd.RemoveFile("a.go")
+	if err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	files := fragmentFiles(getClones(t, cd))
+	if len(files) != 1 || files[0] != "c.go d.go" {
+		t.Errorf("unexpected clones after removing a.go: %v", files)
+	}
+
+	err = cd.RemoveFile("a.go")
+	if !errors.Is(err, clone.ErrFileNotFound) {
+		t.Errorf("unexpected error removing a removed file: %v", err)
+	}
+}
+
+type engine struct {
+	name          string
+	newSuffixTree func() clone.SuffixTree
+}
+
+var engines = []engine{
+	{
+		name:          "stree",
+		newSuffixTree: func() clone.SuffixTree { return stree.NewSTree() },
+	},
+	{
+		name:          "sarray",
+		newSuffixTree: func() clone.SuffixTree { return sarray.NewSuffixArray() },
+	},
+}
+
+// duplicatedSources 完全に一致するクローン・名前の異なるクローン・複数の関数にまたがるクローンを含むファイル
+var duplicatedSources = []source{
+	{"a.go", sumSource},
+	{"b.go", countSource},
+	{"c.go", joinSource},
+	{"d.go", sumSource + joinSource[len("package p\n"):]},
+}
+
+func clonePairStrings(clonePairs []*clone.ClonePair) []string {
+	lines := make([]string, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		lines = append(lines, fmt.Sprintf("%s %s %s %d %s", clonePair.Fragment1, clonePair.Fragment2, clonePair.Type, clonePair.Fragment1.TokenCount, clonePair.Fingerprint))
+	}
+
+	return lines
+}
+
+func cloneClassStrings(cloneClasses []*clone.CloneClass) []string {
+	lines := make([]string, 0, len(cloneClasses))
+	for _, cloneClass := range cloneClasses {
+		lines = append(lines, fmt.Sprintf("%v %s %d %s", cloneClass.Fragments, cloneClass.Type, cloneClass.TokenCount, cloneClass.Fingerprint))
+	}
+
+	return lines
+}
+
+func TestAddFilesSameAsAddNode(t *testing.T) {
+	dir := t.TempDir()
+	filenames := make([]string, 0, len(duplicatedSources))
+	for _, s := range duplicatedSources {
+		filename := filepath.Join(dir, s.filename)
+		err := os.WriteFile(filename, []byte(s.src), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", s.filename, err)
+		}
+		filenames = append(filenames, filename)
+	}
+
+	// 検出の順は接尾辞木の構造に依存するので、並べ替えて比べる
+	sortedStrings := func(cd *clone.CloneDetector) ([]string, []string) {
+		clonePairs := clonePairStrings(getClones(t, cd))
+		sort.Strings(clonePairs)
+
+		cloneClasses, err := cd.GetCloneClasses()
+		if err != nil {
+			t.Fatalf("failed to get clone classes: %v", err)
+		}
+		classes := cloneClassStrings(cloneClasses)
+		sort.Strings(classes)
+
+		return clonePairs, classes
+	}
+
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			// 1つずつ順に追加したものと、並行に追加したものを比べる
+			sequential := clone.NewCloneDetector(&clone.Config{Threshold: 10, MaxGap: 10, SuffixTree: e.newSuffixTree()})
+			for _, filename := range filenames {
+				file, err := parser.ParseFile(sequential.FileSet(), filename, nil, 0)
+				if err != nil {
+					t.Fatalf("failed to parse %s: %v", filename, err)
+				}
+
+				err = sequential.AddNode(context.Background(), file)
+				if err != nil {
+					t.Fatalf("failed to add %s: %v", filename, err)
+				}
+			}
+
+			expectedPairs, expectedClasses := sortedStrings(sequential)
+			if len(expectedPairs) == 0 {
+				t.Fatal("no clones found")
+			}
+
+			for _, concurrency := range []int{1, 2, len(filenames) + 1} {
+				concurrent := clone.NewCloneDetector(&clone.Config{Concurrency: concurrency, Threshold: 10, MaxGap: 10, SuffixTree: e.newSuffixTree()})
+				err := concurrent.AddFiles(context.Background(), filenames)
+				if err != nil {
+					t.Fatalf("failed to add files: %v", err)
+				}
+
+				actualPairs, actualClasses := sortedStrings(concurrent)
+				if !reflect.DeepEqual(expectedPairs, actualPairs) {
+					t.Errorf("clones differ with concurrency %d:\nexpected %v\nactual   %v", concurrency, expectedPairs, actualPairs)
+				}
+				if !reflect.DeepEqual(expectedClasses, actualClasses) {
+					t.Errorf("clone classes differ with concurrency %d:\nexpected %v\nactual   %v", concurrency, expectedClasses, actualClasses)
+				}
+			}
+		})
+	}
+}
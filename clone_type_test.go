@@ -0,0 +1,90 @@
+package clone
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+func TestClassifyCloneType(t *testing.T) {
+	parseDecl := func(decl string) []ast.Node {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", "package p\n\n"+decl+"\n", 0)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", decl, err)
+		}
+
+		return []ast.Node{file.Decls[0]}
+	}
+
+	tests := []struct {
+		description  string
+		decl1, decl2 string
+		expected     CloneType
+	}{
+		{
+			description: "same code",
+			decl1:       "var v = f(xs)",
+			decl2:       "var v = f(xs)",
+			expected:    CloneType1,
+		},
+		{
+			description: "renamed identifier",
+			decl1:       "var v = f(xs)",
+			decl2:       "var v = f(ys)",
+			expected:    CloneType2,
+		},
+		{
+			description: "variadic call",
+			decl1:       "var v = f(xs...)",
+			decl2:       "var v = f(xs)",
+			expected:    CloneType2,
+		},
+		{
+			description: "3-index slice",
+			decl1:       "var v = s[a:b]",
+			decl2:       "var v = s[a:b:c]",
+			expected:    CloneType3,
+		},
+		{
+			description: "3-index slice without low",
+			decl1:       "var v = s[:a:b]",
+			decl2:       "var v = s[a:b]",
+			expected:    CloneType2,
+		},
+		{
+			description: "slice bounds",
+			decl1:       "var v = s[a:]",
+			decl2:       "var v = s[:a]",
+			expected:    CloneType2,
+		},
+		{
+			description: "type alias",
+			decl1:       "type A = B",
+			decl2:       "type A B",
+			expected:    CloneType2,
+		},
+		{
+			description: "elided composite literal type",
+			decl1:       "var v = []T{{T, a}}",
+			decl2:       "var v = []T{T{a}}",
+			expected:    CloneType2,
+		},
+		{
+			description: "parameters and results",
+			decl1:       "var f func(a int)",
+			decl2:       "var f func() (a int)",
+			expected:    CloneType3,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			actual := classifyCloneType(parseDecl(test.decl1), parseDecl(test.decl2))
+			if actual != test.expected {
+				t.Errorf("%q and %q: expected %s, actual %s", test.decl1, test.decl2, test.expected, actual)
+			}
+		})
+	}
+}
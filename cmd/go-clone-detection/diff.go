@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext 差分の前後に表示する変更のない行数
+const diffContext = 3
+
+type diffOp int
+
+const (
+	diffEqual diffOp = iota
+	diffDelete
+	diffInsert
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// writeDiff srcとfixedの行単位の差分をunified形式で書き出す
+func writeDiff(w io.Writer, filename string, src, fixed []byte) error {
+	lines := diffLines(splitLines(string(src)), splitLines(string(fixed)))
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", filename, filename)
+
+	// 変更のある行の前後diffContext行をまとめてhunkにする
+	srcLine, fixedLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == diffEqual {
+			srcLine++
+			fixedLine++
+			i++
+			continue
+		}
+
+		start := i - diffContext
+		if start < 0 {
+			start = 0
+		}
+		hunkSrcLine, hunkFixedLine := srcLine-(i-start), fixedLine-(i-start)
+
+		end := i
+		for equal := 0; end < len(lines) && equal <= 2*diffContext; end++ {
+			if lines[end].op == diffEqual {
+				equal++
+			} else {
+				equal = 0
+			}
+		}
+		// hunkの末尾の変更のない行はdiffContext行まで残す
+		for end > i && lines[end-1].op == diffEqual && countTrailingEqual(lines[i:end]) > diffContext {
+			end--
+		}
+
+		var srcCount, fixedCount int
+		var hunk strings.Builder
+		for _, line := range lines[start:end] {
+			switch line.op {
+			case diffEqual:
+				srcCount++
+				fixedCount++
+				hunk.WriteString(" " + line.text)
+			case diffDelete:
+				srcCount++
+				hunk.WriteString("-" + line.text)
+			case diffInsert:
+				fixedCount++
+				hunk.WriteString("+" + line.text)
+			}
+			if !strings.HasSuffix(line.text, "\n") {
+				hunk.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunkSrcLine, srcCount, hunkFixedLine, fixedCount)
+		sb.WriteString(hunk.String())
+
+		for _, line := range lines[i:end] {
+			if line.op != diffInsert {
+				srcLine++
+			}
+			if line.op != diffDelete {
+				fixedLine++
+			}
+		}
+		i = end
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	if err != nil {
+		return fmt.Errorf("failed to write diff: %w", err)
+	}
+
+	return nil
+}
+
+func countTrailingEqual(lines []diffLine) int {
+	count := 0
+	for i := len(lines) - 1; i >= 0 && lines[i].op == diffEqual; i-- {
+		count++
+	}
+
+	return count
+}
+
+// splitLines 改行を残したまま行に分ける
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	return lines
+}
+
+// diffLines 最長共通部分列から行の差分を求める(先頭と末尾の共通部分は除いてから求める)
+func diffLines(a, b []string) []diffLine {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	lines := make([]diffLine, 0, len(a)+len(b))
+	for _, text := range a[:prefix] {
+		lines = append(lines, diffLine{op: diffEqual, text: text})
+	}
+
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+	lcs := make([][]int32, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			lines = append(lines, diffLine{op: diffEqual, text: midA[i]})
+			i++
+			j++
+		case j == len(midB) || (i < len(midA) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{op: diffDelete, text: midA[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{op: diffInsert, text: midB[j]})
+			j++
+		}
+	}
+
+	for _, text := range a[len(a)-suffix:] {
+		lines = append(lines, diffLine{op: diffEqual, text: text})
+	}
+
+	return lines
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// collectFiles ./...形式のパターン・ディレクトリ・ファイルから対象のGoファイルを列挙する
+func collectFiles(patterns []string, includeTests bool) ([]string, error) {
+	fileMap := map[string]struct{}{}
+	for _, pattern := range patterns {
+		var files []string
+		var err error
+		if dir := strings.TrimSuffix(pattern, "..."); dir != pattern {
+			dir = strings.TrimSuffix(dir, "/")
+			if dir == "" {
+				dir = "."
+			}
+
+			files, err = walkDir(dir, includeTests)
+		} else {
+			files, err = listPath(pattern, includeTests)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to expand pattern %s: %w", pattern, err)
+		}
+
+		for _, file := range files {
+			fileMap[file] = struct{}{}
+		}
+	}
+
+	files := make([]string, 0, len(fileMap))
+	for file := range fileMap {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	return files, nil
+}
+
+func walkDir(root string, includeTests bool) ([]string, error) {
+	files := []string{}
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			// goコマンドと同様にvendor, testdata, ., _で始まるディレクトリは無視する
+			if path != root && isIgnoredDir(d.Name()) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if isTargetFile(d.Name(), includeTests) {
+			files = append(files, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+func listPath(path string, includeTests bool) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+
+	files := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && isTargetFile(entry.Name(), includeTests) {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+func isIgnoredDir(name string) bool {
+	return name == "vendor" ||
+		name == "testdata" ||
+		strings.HasPrefix(name, ".") ||
+		strings.HasPrefix(name, "_")
+}
+
+func isTargetFile(name string, includeTests bool) bool {
+	if !strings.HasSuffix(name, ".go") ||
+		strings.HasPrefix(name, ".") ||
+		strings.HasPrefix(name, "_") {
+		return false
+	}
+
+	return includeTests || !strings.HasSuffix(name, "_test.go")
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// createTree dirの下に空のGoファイルを作る
+func createTree(t *testing.T, dir string, filenames ...string) {
+	t.Helper()
+
+	for _, filename := range filenames {
+		path := filepath.Join(dir, filepath.FromSlash(filename))
+		err := os.MkdirAll(filepath.Dir(path), 0o755)
+		if err != nil {
+			t.Fatalf("failed to create directory: %v", err)
+		}
+
+		err = os.WriteFile(path, []byte("package p\n"), 0o644)
+		if err != nil {
+			t.Fatalf("failed to create %s: %v", filename, err)
+		}
+	}
+}
+
+func TestCollectFiles(t *testing.T) {
+	dir := t.TempDir()
+	createTree(t, dir,
+		"a.go",
+		"a_test.go",
+		".hidden.go",
+		"_ignored.go",
+		"README.md",
+		"sub/b.go",
+		"sub/b_test.go",
+		"sub/testdata/c.go",
+		"sub/deep/d.go",
+		"vendor/e.go",
+		".git/f.go",
+		"_tools/g.go",
+	)
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("failed to get working directory: %v", err)
+	}
+	err = os.Chdir(dir)
+	if err != nil {
+		t.Fatalf("failed to change directory: %v", err)
+	}
+	defer func() {
+		err := os.Chdir(wd)
+		if err != nil {
+			t.Fatalf("failed to restore working directory: %v", err)
+		}
+	}()
+
+	tests := []struct {
+		description  string
+		patterns     []string
+		includeTests bool
+		expected     []string
+	}{
+		{
+			description: "current directory recursively",
+			patterns:    []string{"./..."},
+			expected:    []string{"a.go", "sub/b.go", "sub/deep/d.go"},
+		},
+		{
+			description:  "current directory recursively with tests",
+			patterns:     []string{"./..."},
+			includeTests: true,
+			expected:     []string{"a.go", "a_test.go", "sub/b.go", "sub/b_test.go", "sub/deep/d.go"},
+		},
+		{
+			description: "subdirectory recursively",
+			patterns:    []string{"sub/..."},
+			expected:    []string{"sub/b.go", "sub/deep/d.go"},
+		},
+		{
+			description: "directory without subdirectories",
+			patterns:    []string{"sub"},
+			expected:    []string{"sub/b.go"},
+		},
+		{
+			description: "explicit testdata directory",
+			patterns:    []string{"sub/testdata/..."},
+			expected:    []string{"sub/testdata/c.go"},
+		},
+		{
+			description: "file",
+			patterns:    []string{"a_test.go"},
+			expected:    []string{"a_test.go"},
+		},
+		{
+			description: "overlapping patterns",
+			patterns:    []string{"./...", "sub", "a.go"},
+			expected:    []string{"a.go", "sub/b.go", "sub/deep/d.go"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			files, err := collectFiles(test.patterns, test.includeTests)
+			if err != nil {
+				t.Fatalf("failed to collect files: %v", err)
+			}
+
+			expected := make([]string, 0, len(test.expected))
+			for _, file := range test.expected {
+				expected = append(expected, filepath.FromSlash(file))
+			}
+			if !reflect.DeepEqual(expected, files) {
+				t.Errorf("unexpected files: expected %v, actual %v", expected, files)
+			}
+		})
+	}
+
+	_, err = collectFiles([]string{"missing"}, false)
+	if err == nil {
+		t.Error("collecting a missing path should fail")
+	}
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// fix locationのコード片を含むクローンクラスを関数にまとめ、ファイルを書き換えるかdryRunの場合は差分を書き出す
+func fix(w io.Writer, cd *clone.CloneDetector, location string, dryRun bool) error {
+	i := strings.LastIndexByte(location, ':')
+	if i < 0 {
+		return fmt.Errorf("invalid fix location(%s): expected file:line", location)
+	}
+
+	filename, err := filepath.Abs(location[:i])
+	if err != nil {
+		return fmt.Errorf("invalid fix location(%s): %w", location, err)
+	}
+
+	line, err := strconv.Atoi(location[i+1:])
+	if err != nil {
+		return fmt.Errorf("invalid fix location(%s): %w", location, err)
+	}
+
+	cloneClasses, err := cd.GetCloneClasses()
+	if err != nil {
+		return fmt.Errorf("failed to get clone classes: %w", err)
+	}
+
+	// 位置を含むコード片のうち最も大きいクローンクラスを選ぶ
+	var selected *clone.CloneClass
+	for _, cloneClass := range cloneClasses {
+		for _, fragment := range cloneClass.Fragments {
+			fragmentFilename, err := filepath.Abs(fragment.Filename)
+			if err != nil || fragmentFilename != filename || line < fragment.StartLine || fragment.EndLine < line {
+				continue
+			}
+
+			if selected == nil || cloneClass.TokenCount > selected.TokenCount {
+				selected = cloneClass
+			}
+		}
+	}
+	if selected == nil {
+		return fmt.Errorf("no clone found at %s", location)
+	}
+
+	fixedFiles, err := cd.FixCloneClass(selected)
+	if errors.Is(err, clone.ErrNotExtractable) || errors.Is(err, clone.ErrNotSharable) {
+		return fmt.Errorf("cannot fix clone at %s: %w", location, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fix clone: %w", err)
+	}
+
+	for _, fixedFile := range fixedFiles {
+		if dryRun {
+			err = writeDiff(w, fixedFile.Filename, fixedFile.Src, fixedFile.Fixed)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		info, err := os.Stat(fixedFile.Filename)
+		if err != nil {
+			return fmt.Errorf("failed to stat file: %w", err)
+		}
+
+		err = os.WriteFile(fixedFile.Filename, fixedFile.Fixed, info.Mode().Perm())
+		if err != nil {
+			return fmt.Errorf("failed to write file: %w", err)
+		}
+
+		_, err = fmt.Fprintf(w, "fixed %s\n", fixedFile.Filename)
+		if err != nil {
+			return fmt.Errorf("failed to write result: %w", err)
+		}
+	}
+
+	return nil
+}
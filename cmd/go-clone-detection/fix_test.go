@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func fixOptions(location string, dryRun bool) *options {
+	return &options{
+		threshold:   clone.DefaultConfig.Threshold,
+		format:      "text",
+		fix:         location,
+		dryRun:      dryRun,
+		granularity: "any",
+		engine:      "stree",
+	}
+}
+
+// copyDir dirのファイルを一時ディレクトリに複製する
+func copyDir(t *testing.T, dir string) string {
+	t.Helper()
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+
+	tmpDir := t.TempDir()
+	for _, entry := range entries {
+		src, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			t.Fatalf("failed to read file: %v", err)
+		}
+
+		err = os.WriteFile(filepath.Join(tmpDir, entry.Name()), src, 0o644)
+		if err != nil {
+			t.Fatalf("failed to write file: %v", err)
+		}
+	}
+
+	return tmpDir
+}
+
+// typeCheck dirのファイルがパースでき、型検査を通るか確かめる
+func typeCheck(t *testing.T, dir string) {
+	t.Helper()
+
+	filenames, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+
+	fset := token.NewFileSet()
+	files := make([]*ast.File, 0, len(filenames))
+	for _, filename := range filenames {
+		file, err := parser.ParseFile(fset, filename, nil, 0)
+		if err != nil {
+			t.Fatalf("failed to parse fixed file: %v", err)
+		}
+		files = append(files, file)
+	}
+
+	config := &types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	_, err = config.Check(files[0].Name.Name, fset, files, nil)
+	if err != nil {
+		t.Fatalf("fixed files do not compile: %v", err)
+	}
+}
+
+func TestFixDryRun(t *testing.T) {
+	dir := filepath.Join("testdata", "fix")
+	golden := filepath.Join("testdata", "fix.golden")
+
+	var buf bytes.Buffer
+	err := run(context.Background(), &buf, []string{dir}, fixOptions(filepath.Join(dir, "a.go")+":10", true))
+	if err != nil {
+		t.Fatalf("failed to fix: %v", err)
+	}
+
+	if *update {
+		err := os.WriteFile(golden, buf.Bytes(), 0o644)
+		if err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if buf.String() != string(expected) {
+		t.Errorf("unexpected diff:\nexpected\n%s\nactual\n%s", expected, buf.String())
+	}
+
+	// dry-runではファイルを書き換えない
+	src, err := os.ReadFile(filepath.Join(dir, "b.go"))
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if !strings.Contains(string(src), "goodbye") {
+		t.Error("dry-run rewrote the file")
+	}
+}
+
+func TestFix(t *testing.T) {
+	dir := copyDir(t, filepath.Join("testdata", "fix"))
+
+	var buf bytes.Buffer
+	err := run(context.Background(), &buf, []string{dir}, fixOptions(filepath.Join(dir, "a.go")+":10", false))
+	if err != nil {
+		t.Fatalf("failed to fix: %v", err)
+	}
+
+	typeCheck(t, dir)
+
+	src, err := os.ReadFile(filepath.Join(dir, "b.go"))
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if !strings.Contains(string(src), "return extracted(people, \"goodbye, %s\\n\")") {
+		t.Errorf("clone in b.go is not replaced:\n%s", src)
+	}
+}
+
+func TestFixFormat(t *testing.T) {
+	for _, format := range []string{"json", "sarif"} {
+		opts := fixOptions(filepath.Join("testdata", "fix", "a.go")+":10", true)
+		opts.format = format
+
+		err := run(context.Background(), &bytes.Buffer{}, []string{filepath.Join("testdata", "fix")}, opts)
+		if err == nil {
+			t.Errorf("no error fixing with %s format", format)
+		}
+	}
+}
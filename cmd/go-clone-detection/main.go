@@ -0,0 +1,429 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/baseline"
+	"github.com/mazrean/go-clone-detection/report"
+	"github.com/mazrean/go-clone-detection/sarray"
+	"github.com/mazrean/go-clone-detection/serializer"
+	"github.com/mazrean/go-clone-detection/stree"
+)
+
+const usage = `usage: go-clone-detection [flags] [packages]
+
+Packages are given as directories, Go files or ./... style patterns.
+The default is the current directory.
+
+Flags:
+`
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+
+	threshold := flag.Int("threshold", clone.DefaultConfig.Threshold, "minimum number of AST nodes in a clone")
+	maxGap := flag.Int("max-gap", 0, "maximum number of AST nodes between exact clones merged into a gapped (Type-3) clone; 0 disables")
+	parameterized := flag.Bool("parameterized", false, "drop clones whose identifiers are not consistently renamed")
+	matchIdentifiers := flag.Bool("match-identifiers", false, "only match clones with identical identifier names")
+	matchLiterals := flag.Bool("match-literals", false, "only match clones with identical literal values")
+	renames := flag.Bool("renames", false, "report identifiers left over from an incomplete rename between clones instead of clones (text format only)")
+	baselineFile := flag.String("baseline", "", "report only clones not recorded in this baseline file")
+	writeBaselineFile := flag.String("write-baseline", "", "write the current clones to this baseline file instead of reporting them")
+	setExitStatus := flag.Bool("set-exit-status", false, "exit with status 1 if any clone is reported")
+	includeTests := flag.Bool("test", false, "include _test.go files")
+	format := flag.String("format", "text", "output format (text, json, sarif)")
+	classes := flag.Bool("classes", false, "group clones into clone classes (text format only)")
+	suggest := flag.Bool("suggest", false, "suggest a function extracting each clone (text format only)")
+	generics := flag.Bool("generics", false, "also suggest generic functions for clone classes that differ only by types (text format only)")
+	fix := flag.String("fix", "", "extract the clone class with a fragment at this file:line into a function and rewrite the files (text format only)")
+	dryRun := flag.Bool("dry-run", false, "print the changes made by -fix as a diff instead of writing the files")
+	granularity := flag.String("granularity", "any", "syntactic unit clones are aligned to (any, function, block, statement, expression)")
+	engine := flag.String("engine", "stree", "index used to find clones (stree: suffix tree, sarray: suffix array, uses less memory)")
+	flag.Parse()
+
+	patterns := flag.Args()
+	if len(patterns) == 0 {
+		patterns = []string{"."}
+	}
+
+	err := run(context.Background(), os.Stdout, patterns, &options{
+		threshold:     *threshold,
+		maxGap:        *maxGap,
+		parameterized: *parameterized,
+		matchMode:     matchMode(*matchIdentifiers, *matchLiterals),
+		includeTests:  *includeTests,
+		format:        *format,
+		classes:       *classes,
+		renames:       *renames,
+		suggest:       *suggest,
+		generics:      *generics,
+		fix:           *fix,
+		dryRun:        *dryRun,
+		baseline:      *baselineFile,
+		writeBaseline: *writeBaselineFile,
+		granularity:   *granularity,
+		engine:        *engine,
+	})
+	if errors.Is(err, errClonesFound) {
+		if *setExitStatus {
+			os.Exit(1)
+		}
+		err = nil
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "go-clone-detection: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func matchMode(matchIdentifiers, matchLiterals bool) serializer.Mode {
+	var mode serializer.Mode
+	if matchIdentifiers {
+		mode |= serializer.ModeIdentifier
+	}
+	if matchLiterals {
+		mode |= serializer.ModeLiteral
+	}
+
+	return mode
+}
+
+type options struct {
+	threshold     int
+	maxGap        int
+	parameterized bool
+	matchMode     serializer.Mode
+	includeTests  bool
+	format        string
+	classes       bool
+	renames       bool
+	suggest       bool
+	generics      bool
+	fix           string
+	dryRun        bool
+	baseline      string
+	writeBaseline string
+	granularity   string
+	engine        string
+}
+
+// errClonesFound クローンを1つ以上報告したことを表す
+var errClonesFound = errors.New("clones found")
+
+func run(ctx context.Context, w io.Writer, patterns []string, opts *options) error {
+	var writeClones func(io.Writer, []*clone.ClonePair) error
+	switch opts.format {
+	case "text":
+		writeClones = writeText
+	case "json":
+		writeClones = report.WriteJSON
+	case "sarif":
+		writeClones = report.WriteSARIF
+	default:
+		return fmt.Errorf("unknown format: %s", opts.format)
+	}
+
+	if opts.classes && opts.format != "text" {
+		return fmt.Errorf("clone classes are not supported in %s format", opts.format)
+	}
+
+	if opts.renames && opts.format != "text" {
+		return fmt.Errorf("inconsistent renames are not supported in %s format", opts.format)
+	}
+
+	if opts.suggest && (opts.format != "text" || opts.classes || opts.renames) {
+		return errors.New("suggestions can only be used for clone pairs in text format")
+	}
+
+	if opts.generics && (opts.format != "text" || opts.renames || opts.baseline != "" || opts.writeBaseline != "") {
+		return errors.New("generic suggestions can only be used for clones in text format")
+	}
+
+	if opts.fix != "" && (opts.classes || opts.renames || opts.suggest || opts.generics || opts.baseline != "" || opts.writeBaseline != "") {
+		return errors.New("fix cannot be used with other reports")
+	}
+
+	if opts.fix != "" && opts.format != "text" {
+		return fmt.Errorf("fix cannot be used with %s format", opts.format)
+	}
+
+	if opts.dryRun && opts.fix == "" {
+		return errors.New("dry-run can only be used with fix")
+	}
+
+	if (opts.baseline != "" || opts.writeBaseline != "") && (opts.classes || opts.renames) {
+		return errors.New("baseline can only be used for clone pairs")
+	}
+
+	var granularity clone.Granularity
+	switch opts.granularity {
+	case "any":
+		granularity = clone.GranularityAny
+	case "function":
+		granularity = clone.GranularityFunction
+	case "block":
+		granularity = clone.GranularityBlock
+	case "statement":
+		granularity = clone.GranularityStatementSequence
+	case "expression":
+		granularity = clone.GranularityExpression
+	default:
+		return fmt.Errorf("unknown granularity: %s", opts.granularity)
+	}
+
+	var suffixTree clone.SuffixTree
+	switch opts.engine {
+	case "stree":
+		suffixTree = stree.NewSTree()
+	case "sarray":
+		suffixTree = sarray.NewSuffixArray()
+	default:
+		return fmt.Errorf("unknown engine: %s", opts.engine)
+	}
+
+	files, err := collectFiles(patterns, opts.includeTests)
+	if err != nil {
+		return err
+	}
+
+	var knownClones *baseline.Baseline
+	if opts.baseline != "" {
+		knownClones, err = readBaseline(opts.baseline)
+		if err != nil {
+			return err
+		}
+	}
+
+	config := *clone.DefaultConfig
+	config.Threshold = opts.threshold
+	config.MaxGap = opts.maxGap
+	config.ParameterizedMatch = opts.parameterized
+	config.MatchMode = opts.matchMode
+	config.Granularity = granularity
+	config.SuffixTree = suffixTree
+	cd := clone.NewCloneDetector(&config)
+
+	err = cd.AddFiles(ctx, files)
+	if err != nil {
+		return fmt.Errorf("failed to add files: %w", err)
+	}
+
+	if opts.fix != "" {
+		return fix(w, cd, opts.fix, opts.dryRun)
+	}
+
+	if opts.renames {
+		inconsistentRenames, err := cd.FindInconsistentRenames()
+		if err != nil {
+			return fmt.Errorf("failed to find inconsistent renames: %w", err)
+		}
+
+		err = writeTextRenames(w, inconsistentRenames)
+		if err != nil {
+			return err
+		}
+
+		if len(inconsistentRenames) > 0 {
+			return errClonesFound
+		}
+
+		return nil
+	}
+
+	if opts.classes {
+		cloneClasses, err := cd.GetCloneClasses()
+		if err != nil {
+			return fmt.Errorf("failed to get clone classes: %w", err)
+		}
+
+		err = writeTextClasses(w, cloneClasses)
+		if err != nil {
+			return err
+		}
+
+		if opts.generics {
+			err = writeTextGenerics(w, cd, cloneClasses)
+			if err != nil {
+				return err
+			}
+		}
+
+		if len(cloneClasses) > 0 {
+			return errClonesFound
+		}
+
+		return nil
+	}
+
+	clonePairs, err := cd.GetClones()
+	if err != nil {
+		return fmt.Errorf("failed to get clones: %w", err)
+	}
+
+	if opts.writeBaseline != "" {
+		return writeBaseline(opts.writeBaseline, clonePairs)
+	}
+
+	if knownClones != nil {
+		clonePairs = knownClones.Filter(clonePairs)
+	}
+
+	if opts.suggest {
+		err = writeTextSuggestions(w, cd, clonePairs)
+	} else {
+		err = writeClones(w, clonePairs)
+	}
+	if err != nil {
+		return err
+	}
+
+	if opts.generics {
+		cloneClasses, err := cd.GetCloneClasses()
+		if err != nil {
+			return fmt.Errorf("failed to get clone classes: %w", err)
+		}
+
+		err = writeTextGenerics(w, cd, cloneClasses)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(clonePairs) > 0 {
+		return errClonesFound
+	}
+
+	return nil
+}
+
+func readBaseline(filename string) (*baseline.Baseline, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open baseline: %w", err)
+	}
+	defer f.Close()
+
+	knownClones, err := baseline.Read(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read baseline(%s): %w", filename, err)
+	}
+
+	return knownClones, nil
+}
+
+func writeBaseline(filename string, clonePairs []*clone.ClonePair) error {
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("failed to create baseline: %w", err)
+	}
+	defer f.Close()
+
+	err = baseline.New(clonePairs).Write(f)
+	if err != nil {
+		return fmt.Errorf("failed to write baseline(%s): %w", filename, err)
+	}
+
+	return nil
+}
+
+func writeText(w io.Writer, clonePairs []*clone.ClonePair) error {
+	for _, clonePair := range clonePairs {
+		_, err := fmt.Fprintf(
+			w,
+			"%s: %s clone of %s (%d nodes, similarity %.2f)\n",
+			clonePair.Fragment1,
+			clonePair.Type,
+			clonePair.Fragment2,
+			clonePair.Fragment1.TokenCount,
+			clonePair.Similarity,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to write clone: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeTextSuggestions クローンごとに、関数に抽出できる場合はその提案も書き出す
+func writeTextSuggestions(w io.Writer, cd *clone.CloneDetector, clonePairs []*clone.ClonePair) error {
+	for _, clonePair := range clonePairs {
+		err := writeText(w, []*clone.ClonePair{clonePair})
+		if err != nil {
+			return err
+		}
+
+		suggestion, err := cd.SuggestExtraction(clonePair)
+		if errors.Is(err, clone.ErrNotExtractable) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to suggest extraction: %w", err)
+		}
+
+		_, err = fmt.Fprint(w, suggestion)
+		if err != nil {
+			return fmt.Errorf("failed to write suggestion: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// writeTextGenerics 型だけが異なるクローンクラスについて、ジェネリックな関数にまとめる提案を書き出す
+func writeTextGenerics(w io.Writer, cd *clone.CloneDetector, cloneClasses []*clone.CloneClass) error {
+	for _, cloneClass := range cloneClasses {
+		suggestion, err := cd.SuggestGenericExtraction(cloneClass)
+		if errors.Is(err, clone.ErrNotGeneric) || errors.Is(err, clone.ErrNotExtractable) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to suggest generic function: %w", err)
+		}
+
+		_, err = fmt.Fprint(w, suggestion)
+		if err != nil {
+			return fmt.Errorf("failed to write suggestion: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func writeTextClasses(w io.Writer, cloneClasses []*clone.CloneClass) error {
+	for _, cloneClass := range cloneClasses {
+		_, err := fmt.Fprintf(w, "%s clone class of %d fragments (%d nodes)\n", cloneClass.Type, len(cloneClass.Fragments), cloneClass.TokenCount)
+		if err != nil {
+			return fmt.Errorf("failed to write clone class: %w", err)
+		}
+
+		for _, fragment := range cloneClass.Fragments {
+			_, err := fmt.Fprintf(w, "\t%s\n", fragment)
+			if err != nil {
+				return fmt.Errorf("failed to write clone class: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeTextRenames(w io.Writer, inconsistentRenames []*clone.InconsistentRename) error {
+	for _, inconsistentRename := range inconsistentRenames {
+		_, err := fmt.Fprintln(w, inconsistentRename)
+		if err != nil {
+			return fmt.Errorf("failed to write inconsistent rename: %w", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,16 @@
+package fixdata
+
+import (
+	"fmt"
+	"strings"
+)
+
+func Greet(names []string) string {
+	var sb strings.Builder
+	for _, name := range names {
+		if name != "" {
+			fmt.Fprintf(&sb, "hello, %s\n", name)
+		}
+	}
+	return sb.String()
+}
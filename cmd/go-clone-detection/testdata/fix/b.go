@@ -0,0 +1,18 @@
+package fixdata
+
+import (
+	"fmt"
+	"strings"
+)
+
+const separator = ", "
+
+func Farewell(people []string) string {
+	var sb strings.Builder
+	for _, person := range people {
+		if person != "" {
+			fmt.Fprintf(&sb, "goodbye, %s\n", person)
+		}
+	}
+	return sb.String()
+}
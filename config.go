@@ -1,5 +1,11 @@
 package clone
 
+import (
+	"go/token"
+
+	"github.com/mazrean/go-clone-detection/serializer"
+)
+
 var (
 	DefaultConfig = &Config{
 		BufSize:   100,
@@ -10,8 +16,29 @@ var (
 type Config struct {
 	// AddFile時のチャネルのバッファーサイズ(デフォルト:100)
 	BufSize int
+	// AddFiles・AddNodesで並行にパース・変換するファイル数(0の場合はGOMAXPROCS)
+	Concurrency int
 	// 連続トークン数の境界値(デフォルト:100)
 	Threshold int
+	/*
+		Type-3クローンとして結合するクローン間の最大のギャップ(ノード数)
+		0の場合はギャップのあるクローンを検出しない
+		結合のために接尾辞木が見つけた全てのクローンの組を保持するので、
+		EachCloneでもメモリ使用量がクローンの数に比例して増える
+	*/
+	MaxGap int
+	/*
+		識別子名・リテラルの値のうち比較に含めるもの(デフォルト:どちらも区別しない)
+		Serializerを指定した場合は使われない
+	*/
+	MatchMode serializer.Mode
+	// 識別子の間に一対一の対応がない(名前の置き換えが一貫していない)クローンを除くか
+	ParameterizedMatch bool
+	// 報告するクローンの構文上の単位(デフォルト:閾値より大きい任意の部分木)
+	// MaxGapと合わせて指定した場合、ギャップのあるクローンはギャップを含む単位の部分木全体を覆うものだけをその部分木として報告する
+	Granularity Granularity
+	// 位置情報の解決に使うFileSet(nilの場合はCloneDetectorが新しく作成する)
+	FileSet *token.FileSet
 	Serializer
 	SuffixTree
 }
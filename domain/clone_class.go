@@ -0,0 +1,33 @@
+package domain
+
+type CloneClass struct {
+	sequences []*CloneSequence
+}
+
+func NewCloneClass(sequences []*CloneSequence) *CloneClass {
+	return &CloneClass{
+		sequences: sequences,
+	}
+}
+
+func (cc *CloneClass) GetSequences() []*CloneSequence {
+	return cc.sequences
+}
+
+// GetDocuments 各シーケンスが含まれる入力のインデックス
+func (cc *CloneClass) GetDocuments() []int {
+	documents := make([]int, 0, len(cc.sequences))
+	for _, sequence := range cc.sequences {
+		documents = append(documents, sequence.GetDocument())
+	}
+
+	return documents
+}
+
+func (cc *CloneClass) GetLength() int {
+	if len(cc.sequences) == 0 {
+		return 0
+	}
+
+	return cc.sequences[0].GetLength()
+}
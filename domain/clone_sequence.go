@@ -0,0 +1,34 @@
+package domain
+
+// CloneSequence 入力中の連続したノード列
+type CloneSequence struct {
+	document int
+	index    int
+	nodes    []*Node
+}
+
+func NewCloneSequence(document int, index int, nodes []*Node) *CloneSequence {
+	return &CloneSequence{
+		document: document,
+		index:    index,
+		nodes:    nodes,
+	}
+}
+
+// GetDocument ノード列が含まれる入力のインデックス
+func (cs *CloneSequence) GetDocument() int {
+	return cs.document
+}
+
+// GetIndex 全入力を連結したノード列上での先頭の位置
+func (cs *CloneSequence) GetIndex() int {
+	return cs.index
+}
+
+func (cs *CloneSequence) GetNodes() []*Node {
+	return cs.nodes
+}
+
+func (cs *CloneSequence) GetLength() int {
+	return len(cs.nodes)
+}
@@ -1,21 +1,30 @@
 package domain
 
 type CloneSequencePair struct {
-	node1 []*Node
-	node2 []*Node
+	sequence1 *CloneSequence
+	sequence2 *CloneSequence
 }
 
-func NewCloneSequencePair(node1 []*Node, node2 []*Node) *CloneSequencePair {
+func NewCloneSequencePair(sequence1 *CloneSequence, sequence2 *CloneSequence) *CloneSequencePair {
 	return &CloneSequencePair{
-		node1: node1,
-		node2: node2,
+		sequence1: sequence1,
+		sequence2: sequence2,
 	}
 }
 
+func (cp *CloneSequencePair) GetSequences() (*CloneSequence, *CloneSequence) {
+	return cp.sequence1, cp.sequence2
+}
+
 func (cp *CloneSequencePair) GetNodes() ([]*Node, []*Node) {
-	return cp.node1, cp.node2
+	return cp.sequence1.GetNodes(), cp.sequence2.GetNodes()
+}
+
+// GetDocuments 各シーケンスが含まれる入力のインデックス
+func (cp *CloneSequencePair) GetDocuments() (int, int) {
+	return cp.sequence1.GetDocument(), cp.sequence2.GetDocument()
 }
 
 func (cp *CloneSequencePair) GetLength() int {
-	return len(cp.node1)
+	return cp.sequence1.GetLength()
 }
@@ -13,6 +13,7 @@ type Node struct {
 	position   *values.Position
 	childCount values.ChildCount
 	token      values.NodeToken
+	value      values.NodeValue
 }
 
 func NewNode(
@@ -21,6 +22,7 @@ func NewNode(
 	position *values.Position,
 	childCount values.ChildCount,
 	token values.NodeToken,
+	value values.NodeValue,
 ) *Node {
 	return &Node{
 		node:       node,
@@ -28,9 +30,26 @@ func NewNode(
 		position:   position,
 		childCount: childCount,
 		token:      token,
+		value:      value,
 	}
 }
 
+/*
+NewTerminalNode 入力の終端を表す番兵ノードを作る
+入力ごとに異なるノードになるよう、子の数の代わりに入力のインデックスを持たせる
+*/
+func NewTerminalNode(document int) *Node {
+	return &Node{
+		nodeType:   values.NodeTypeTerminal,
+		childCount: values.NewChildCount(int64(document)),
+		token:      values.NodeTokenNone,
+	}
+}
+
+func (n *Node) IsTerminal() bool {
+	return n.nodeType == values.NodeTypeTerminal
+}
+
 func (n *Node) GetNode() ast.Node {
 	return n.node
 }
@@ -54,3 +73,7 @@ func (n *Node) IncrementChildCount(childCount values.ChildCount) {
 func (n *Node) GetToken() values.NodeToken {
 	return n.token
 }
+
+func (n *Node) GetValue() values.NodeValue {
+	return n.value
+}
@@ -0,0 +1,27 @@
+package domain
+
+// SequenceMatch 検索したノード列の一部と一致した、入力中のノード列
+type SequenceMatch struct {
+	queryIndex int
+	sequence   *CloneSequence
+}
+
+func NewSequenceMatch(queryIndex int, sequence *CloneSequence) *SequenceMatch {
+	return &SequenceMatch{
+		queryIndex: queryIndex,
+		sequence:   sequence,
+	}
+}
+
+// GetQueryIndex 一致した部分の検索したノード列上での先頭の位置
+func (sm *SequenceMatch) GetQueryIndex() int {
+	return sm.queryIndex
+}
+
+func (sm *SequenceMatch) GetSequence() *CloneSequence {
+	return sm.sequence
+}
+
+func (sm *SequenceMatch) GetLength() int {
+	return sm.sequence.GetLength()
+}
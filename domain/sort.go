@@ -0,0 +1,51 @@
+package domain
+
+import "sort"
+
+/*
+SortCloneSequencePairs 前にあるノード列が1つ目になるようにそろえ、
+1つ目の位置、2つ目の位置、長さの順に並べる
+入力は追加した順に並ぶので、位置の順は入力の順、入力内の位置の順になる
+*/
+func SortCloneSequencePairs(clonePairs []*CloneSequencePair) {
+	for _, clonePair := range clonePairs {
+		if clonePair.sequence1.index > clonePair.sequence2.index {
+			clonePair.sequence1, clonePair.sequence2 = clonePair.sequence2, clonePair.sequence1
+		}
+	}
+
+	sort.Slice(clonePairs, func(i, j int) bool {
+		pair1, pair2 := clonePairs[i], clonePairs[j]
+		switch {
+		case pair1.sequence1.index != pair2.sequence1.index:
+			return pair1.sequence1.index < pair2.sequence1.index
+		case pair1.sequence2.index != pair2.sequence2.index:
+			return pair1.sequence2.index < pair2.sequence2.index
+		}
+
+		return pair1.GetLength() < pair2.GetLength()
+	})
+}
+
+// SortCloneClasses 各クローンクラスのノード列を位置の順に並べ、先頭のノード列の位置、長さの順にクローンクラスを並べる
+func SortCloneClasses(cloneClasses []*CloneClass) {
+	for _, cloneClass := range cloneClasses {
+		sequences := cloneClass.sequences
+		sort.Slice(sequences, func(i, j int) bool {
+			return sequences[i].index < sequences[j].index
+		})
+	}
+
+	sort.Slice(cloneClasses, func(i, j int) bool {
+		class1, class2 := cloneClasses[i], cloneClasses[j]
+		if len(class1.sequences) == 0 || len(class2.sequences) == 0 {
+			return len(class1.sequences) < len(class2.sequences)
+		}
+
+		if class1.sequences[0].index != class2.sequences[0].index {
+			return class1.sequences[0].index < class2.sequences[0].index
+		}
+
+		return class1.GetLength() < class2.GetLength()
+	})
+}
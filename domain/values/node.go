@@ -8,6 +8,8 @@ type (
 		end   int64
 	}
 	ChildCount int64
+	// 識別子名やリテラルの値のハッシュ(比較しない場合はNodeValueNone)
+	NodeValue uint64
 )
 
 const (
@@ -65,8 +67,13 @@ const (
 	NodeTypeTypeSwitchStmt
 	NodeTypeUnaryExpr
 	NodeTypeValueSpec
+	// 以降はGo 1.18で追加されたノード(既存の値を変えないよう末尾に追加する)
+	NodeTypeIndexListExpr
 )
 
+// NodeTypeTerminal 入力の終端を表す番兵のノード種別(ASTのノードには対応しない)
+const NodeTypeTerminal NodeType = 0xff
+
 const (
 	NodeTokenNone NodeToken = iota
 	NodeTokenIllegal
@@ -127,6 +134,9 @@ const (
 	NodeTokenImport
 	NodeTokenType
 	NodeTokenVar
+
+	// 型制約の~T
+	NodeTokenTilde
 )
 
 func NewPosition(start, end int64) *Position {
@@ -147,3 +157,5 @@ func (p *Position) GetEnd() int64 {
 func NewChildCount(childCount int64) ChildCount {
 	return ChildCount(childCount)
 }
+
+const NodeValueNone NodeValue = 0
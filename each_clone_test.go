@@ -0,0 +1,106 @@
+package clone_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"runtime"
+	"sort"
+	"testing"
+	"time"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+func TestEachCloneSameAsGetClones(t *testing.T) {
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, MaxGap: 10, SuffixTree: e.newSuffixTree()}, duplicatedSources...)
+
+			clonePairs, err := cd.GetClones()
+			if err != nil {
+				t.Fatalf("failed to get clones: %v", err)
+			}
+			if len(clonePairs) == 0 {
+				t.Fatal("no clones found")
+			}
+
+			var eachClonePairs []*clone.ClonePair
+			err = cd.EachClone(context.Background(), func(clonePair *clone.ClonePair) error {
+				eachClonePairs = append(eachClonePairs, clonePair)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to iterate clones: %v", err)
+			}
+
+			// 渡す順は異なるので、並べてから比べる
+			expected := clonePairStrings(clonePairs)
+			actual := clonePairStrings(eachClonePairs)
+			sort.Strings(expected)
+			sort.Strings(actual)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("clones differ from GetClones:\nexpected %v\nactual   %v", expected, actual)
+			}
+		})
+	}
+}
+
+func TestEachCloneStop(t *testing.T) {
+	errStop := errors.New("stop")
+
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, MaxGap: 10, SuffixTree: e.newSuffixTree()}, duplicatedSources...)
+
+			goroutineNum := runtime.NumGoroutine()
+
+			const limit = 3
+			count := 0
+			err := cd.EachClone(context.Background(), func(clonePair *clone.ClonePair) error {
+				count++
+				if count == limit {
+					return errStop
+				}
+
+				return nil
+			})
+			if !errors.Is(err, errStop) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if count != limit {
+				t.Errorf("yield was called %d times after returning an error at %d", count, limit)
+			}
+
+			// 終了したgoroutineが数えられなくなるまで少し待つ
+			for i := 0; i < 100 && runtime.NumGoroutine() > goroutineNum; i++ {
+				time.Sleep(10 * time.Millisecond)
+			}
+			if n := runtime.NumGoroutine(); n > goroutineNum {
+				t.Errorf("goroutines leaked: %d before, %d after", goroutineNum, n)
+			}
+		})
+	}
+}
+
+func TestEachCloneCanceled(t *testing.T) {
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, MaxGap: 10, SuffixTree: e.newSuffixTree()}, duplicatedSources...)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			err := cd.EachClone(ctx, func(clonePair *clone.ClonePair) error {
+				t.Fatal("yield was called after cancellation")
+				return nil
+			})
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,1248 @@
+package clone
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+var ErrNotExtractable = errors.New("clone cannot be extracted into a function")
+
+// ExtractParam 抽出した関数の引数
+type ExtractParam struct {
+	Name string
+	Type string
+	// 各コード片の呼び出しで渡す式
+	Arg1 string
+	Arg2 string
+}
+
+// ExtractSuggestion クローンの2つのコード片を1つの関数にまとめる提案
+type ExtractSuggestion struct {
+	ClonePair *ClonePair
+	// 抽出した関数の名前
+	Name   string
+	Params []*ExtractParam
+	// 抽出した関数の戻り値の型
+	Results []string
+	// 型を推測できずanyにした引数・戻り値
+	UnknownTypes []string
+	// 抽出した関数のソースコード(go/formatで整形したもの、型を推測できなかった場合はその旨のコメントが前に付く)
+	Function string
+	// 各コード片を置き換えるコード(関数全体のクローンの場合は抽出した関数を呼ぶだけの関数になる)
+	Replacement1 string
+	Replacement2 string
+}
+
+func (es *ExtractSuggestion) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s and %s can be extracted into:\n", es.ClonePair.Fragment1, es.ClonePair.Fragment2)
+	sb.WriteString(indent(es.Function))
+	fmt.Fprintf(&sb, "replace %s with:\n", es.ClonePair.Fragment1)
+	sb.WriteString(indent(es.Replacement1))
+	fmt.Fprintf(&sb, "replace %s with:\n", es.ClonePair.Fragment2)
+	sb.WriteString(indent(es.Replacement2))
+
+	return sb.String()
+}
+
+func indent(src string) string {
+	lines := strings.Split(strings.TrimSuffix(src, "\n"), "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = "\t" + line
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// extractName 抽出した関数の名前(コード片中の名前と重なる場合は数字を付ける)
+const extractName = "extracted"
+
+/*
+SuggestExtraction clonePairの2つのコード片を1つの関数にまとめる提案を作る
+異なる識別子・リテラルを引数にし、コード片の後で使われる変数を戻り値にする
+型情報は使わないので、引数・戻り値の型は同じファイル内の宣言や初期化の式から分かる範囲で推測する
+分からない場合はanyにし、UnknownTypesと関数の前のコメントでその引数・戻り値を示す
+構造の異なるクローンや、returnなどでコード片の外に制御が移るもの、deferやrecoverのように外の関数に結び付いたものはErrNotExtractableを返す
+*/
+func (cd *CloneDetector) SuggestExtraction(clonePair *ClonePair) (*ExtractSuggestion, error) {
+	if clonePair.Node1 == nil || clonePair.Node2 == nil {
+		return nil, fmt.Errorf("%w: clone does not consist of a single subtree", ErrNotExtractable)
+	}
+
+	e, err := cd.newExtraction([]ast.Node{clonePair.Node1, clonePair.Node2}, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	suggestion := &ExtractSuggestion{
+		ClonePair:    clonePair,
+		Name:         e.name,
+		UnknownTypes: e.unknownTypes,
+	}
+	for _, param := range e.paramList {
+		suggestion.Params = append(suggestion.Params, &ExtractParam{
+			Name: param.name,
+			Type: formatNode(param.typ),
+			Arg1: formatNode(param.args[0]),
+			Arg2: formatNode(param.args[1]),
+		})
+	}
+	for _, result := range e.resultTypes {
+		suggestion.Results = append(suggestion.Results, formatNode(result))
+	}
+
+	suggestion.Function = e.unknownTypesComment() + formatNode(e.function)
+	suggestion.Replacement1 = formatNode(e.replacements[0])
+	suggestion.Replacement2 = formatNode(e.replacements[1])
+
+	return suggestion, nil
+}
+
+// enclosingFunc nodeを含む最も外側の関数宣言(ファイル全体を追加していない場合はnil)
+func (cd *CloneDetector) enclosingFunc(node ast.Node) *ast.FuncDecl {
+	file, ok := cd.astFiles[cd.fset.File(node.Pos())]
+	if !ok {
+		return nil
+	}
+
+	for _, decl := range file.Decls {
+		if funcDecl, ok := decl.(*ast.FuncDecl); ok && funcDecl.Pos() <= node.Pos() && node.End() <= funcDecl.End() {
+			return funcDecl
+		}
+	}
+
+	return nil
+}
+
+type extractParam struct {
+	name string
+	typ  ast.Expr
+	// 各コード片の呼び出しで渡す式
+	args []ast.Expr
+	// コード片の外で宣言された変数の場合の、各コード片での変数
+	objects []*ast.Object
+}
+
+// extractResult 抽出した関数の戻り値にする変数
+type extractResult struct {
+	// 抽出した関数内での名前と、各コード片での名前
+	name    string
+	objects []*ast.Object
+	typ     ast.Expr
+	// コード片内で宣言された変数か
+	declared bool
+}
+
+type extraction struct {
+	// コード片と、それぞれを含む関数宣言
+	nodes     []ast.Node
+	funcs     []*ast.FuncDecl
+	usedNames map[string]struct{}
+	params    map[string]*extractParam
+	paramList []*extractParam
+	// 先頭のコード片で宣言された変数から、各コード片で対応する変数への対応
+	objects map[*ast.Object][]*ast.Object
+	// 宣言された順の、先頭のコード片で宣言された変数
+	declaredObjects []*ast.Object
+	// 先頭のコード片を複製するときに置き換えるノード
+	replace     map[ast.Node]ast.Node
+	name        string
+	resultTypes []ast.Expr
+	// 型を推測できずanyにした引数・戻り値
+	unknownTypes []string
+
+	// 抽出した関数と、各コード片を置き換えるノード
+	function     *ast.FuncDecl
+	replacements []ast.Node
+	/*
+		抽出した関数の本体の元になる先頭のコード片のノード
+		bodyInnerの場合は括弧の内側、bodyReturnの場合はreturnの後に置き、tailがあれば最後に付け足す
+	*/
+	body       ast.Node
+	bodyInner  bool
+	bodyReturn bool
+	tail       ast.Stmt
+
+	// 型パラメータにした型(genericの場合のみ)
+	generic       bool
+	typeParams    []*typeParam
+	typeParamKeys map[string]*typeParam
+	// 各コード片で型の書かれる位置にあるノード
+	typePositions []map[ast.Node]struct{}
+}
+
+/*
+newExtraction nodesを1つの関数にまとめる方法を求める
+reservedNamesは抽出した関数の名前として使わない名前
+genericの場合は、異なる型を型パラメータにする
+*/
+func (cd *CloneDetector) newExtraction(nodes []ast.Node, reservedNames []string, generic bool) (*extraction, error) {
+	e := &extraction{
+		nodes:         nodes,
+		funcs:         make([]*ast.FuncDecl, len(nodes)),
+		usedNames:     map[string]struct{}{},
+		params:        map[string]*extractParam{},
+		objects:       map[*ast.Object][]*ast.Object{},
+		replace:       map[ast.Node]ast.Node{},
+		generic:       generic,
+		typeParamKeys: map[string]*typeParam{},
+	}
+	for i, node := range nodes {
+		e.funcs[i] = cd.enclosingFunc(node)
+	}
+	for _, name := range reservedNames {
+		e.usedNames[name] = struct{}{}
+	}
+
+	for _, node := range nodes {
+		if callsRecover(node) {
+			return nil, fmt.Errorf("%w: recover is called outside the deferred function", ErrNotExtractable)
+		}
+	}
+
+	err := e.align()
+	if err != nil {
+		return nil, err
+	}
+
+	switch node := nodes[0].(type) {
+	case *ast.FuncDecl:
+		err = e.extractFuncDecl(node)
+	case *ast.CaseClause, *ast.CommClause:
+		err = fmt.Errorf("%w: case clauses cannot be extracted", ErrNotExtractable)
+	case ast.Stmt:
+		err = e.extractStmt()
+	case *ast.ArrayType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType, *ast.MapType, *ast.StructType:
+		err = fmt.Errorf("%w: types cannot be extracted", ErrNotExtractable)
+	case ast.Expr:
+		err = e.extractExpr()
+	default:
+		err = fmt.Errorf("%w: %T cannot be extracted", ErrNotExtractable, node)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.typeParams) > 0 {
+		err = e.addTypeParams()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// align コード片のノードを先頭のコード片と対応付け、異なる識別子・リテラルから引数を作る
+func (e *extraction) align() error {
+	flatNodes := make([][]ast.Node, len(e.nodes))
+	for i, node := range e.nodes {
+		var ok bool
+		flatNodes[i], ok = flattenNodes([]ast.Node{node})
+		if !ok || len(flatNodes[i]) != len(flatNodes[0]) {
+			return fmt.Errorf("%w: structure differs", ErrNotExtractable)
+		}
+
+		for _, flatNode := range flatNodes[i] {
+			if ident, ok := flatNode.(*ast.Ident); ok {
+				e.usedNames[ident.Name] = struct{}{}
+			}
+		}
+	}
+
+	// 関数宣言の名前は呼び出し側に残すので比較しない
+	skip := map[ast.Node]struct{}{}
+	if funcDecl, ok := e.nodes[0].(*ast.FuncDecl); ok {
+		skip[funcDecl.Name] = struct{}{}
+	}
+
+	if e.generic {
+		for _, node := range e.nodes {
+			e.typePositions = append(e.typePositions, typePositions(node))
+		}
+	}
+
+	for j, flatNode := range flatNodes[0] {
+		if _, ok := skip[flatNode]; ok {
+			continue
+		}
+
+		if e.generic {
+			ok, err := e.alignType(flatNodes, j, skip)
+			if err != nil {
+				return err
+			}
+			if ok {
+				continue
+			}
+		}
+
+		var err error
+		switch flatNode.(type) {
+		case *ast.Ident:
+			idents := make([]*ast.Ident, 0, len(flatNodes))
+			for i := range flatNodes {
+				idents = append(idents, flatNodes[i][j].(*ast.Ident))
+			}
+			err = e.alignIdent(idents)
+		case *ast.BasicLit:
+			lits := make([]*ast.BasicLit, 0, len(flatNodes))
+			for i := range flatNodes {
+				lits = append(lits, flatNodes[i][j].(*ast.BasicLit))
+			}
+			err = e.alignLiteral(lits)
+		default:
+			for i := range flatNodes[1:] {
+				if !equalNodeAttributes(flatNode, flatNodes[i+1][j]) {
+					err = fmt.Errorf("%w: operators differ at %T", ErrNotExtractable, flatNode)
+					break
+				}
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	e.name = e.uniqueName(extractName)
+
+	return nil
+}
+
+func (e *extraction) alignLiteral(lits []*ast.BasicLit) error {
+	same := true
+	values := make([]string, 0, len(lits))
+	args := make([]ast.Expr, 0, len(lits))
+	for _, lit := range lits {
+		if lit.Kind != lits[0].Kind {
+			return fmt.Errorf("%w: kinds of literals differ", ErrNotExtractable)
+		}
+
+		same = same && lit.Value == lits[0].Value
+		values = append(values, lit.Value)
+		args = append(args, lit)
+	}
+	if same {
+		return nil
+	}
+
+	key := lits[0].Kind.String() + "\x00" + strings.Join(values, "\x00")
+	param, ok := e.params[key]
+	if !ok {
+		param = e.addParam(key, literalParamName(lits[0].Kind), false, literalType(lits[0].Kind), args)
+	}
+
+	e.replace[lits[0]] = ast.NewIdent(param.name)
+
+	return nil
+}
+
+func (e *extraction) alignIdent(idents []*ast.Ident) error {
+	objects := make([]*ast.Object, 0, len(idents))
+	var unresolved int
+	for _, ident := range idents {
+		objects = append(objects, ident.Obj)
+		if ident.Obj == nil {
+			unresolved++
+		}
+	}
+
+	if unresolved > 0 {
+		// パッケージ外のものやフィールド名など、宣言の分からない名前は引数にできない
+		if unresolved == len(idents) && sameNames(idents) {
+			return nil
+		}
+
+		return fmt.Errorf("%w: %s cannot be parameterized", ErrNotExtractable, identNames(idents))
+	}
+
+	declared := e.contains(0, declPos(objects[0]))
+	for i, object := range objects {
+		if e.contains(i, declPos(object)) != declared {
+			return fmt.Errorf("%w: %s are declared differently", ErrNotExtractable, identNames(idents))
+		}
+	}
+
+	// コード片内で宣言されたものは、先頭のコード片の名前のまま使う
+	if declared {
+		if mapped, ok := e.objects[objects[0]]; ok {
+			for i := range mapped {
+				if mapped[i] != objects[i] {
+					return fmt.Errorf("%w: %s is renamed inconsistently", ErrNotExtractable, idents[0].Name)
+				}
+			}
+			return nil
+		}
+
+		e.objects[objects[0]] = objects
+		e.declaredObjects = append(e.declaredObjects, objects[0])
+
+		return nil
+	}
+
+	// 関数の外で宣言された同じものは、そのまま参照できる
+	var local bool
+	same := true
+	for i, object := range objects {
+		local = local || e.containsFunc(i, declPos(object))
+		same = same && object == objects[0]
+	}
+	if !local && same {
+		return nil
+	}
+
+	for _, object := range objects {
+		switch object.Kind {
+		case ast.Var, ast.Con, ast.Fun:
+		default:
+			return fmt.Errorf("%w: %s cannot be parameterized", ErrNotExtractable, identNames(idents))
+		}
+	}
+
+	keys := make([]string, 0, len(objects))
+	for _, object := range objects {
+		keys = append(keys, fmt.Sprintf("%p", object))
+	}
+	key := strings.Join(keys, "\x00")
+
+	param, ok := e.params[key]
+	if !ok {
+		for _, param := range e.paramList {
+			for i, object := range param.objects {
+				if object != nil && object == objects[i] {
+					return fmt.Errorf("%w: %s is renamed inconsistently", ErrNotExtractable, idents[i].Name)
+				}
+			}
+		}
+
+		typ, err := e.commonType(objects)
+		if err != nil {
+			return err
+		}
+
+		args := make([]ast.Expr, 0, len(objects))
+		for _, object := range objects {
+			args = append(args, ast.NewIdent(object.Name))
+		}
+
+		param = e.addParam(key, objects[0].Name, true, typ, args)
+		param.objects = objects
+	}
+
+	if param.name != idents[0].Name {
+		e.replace[idents[0]] = ast.NewIdent(param.name)
+	}
+
+	return nil
+}
+
+func sameNames(idents []*ast.Ident) bool {
+	for _, ident := range idents {
+		if ident.Name != idents[0].Name {
+			return false
+		}
+	}
+
+	return true
+}
+
+func identNames(idents []*ast.Ident) string {
+	names := make([]string, 0, len(idents))
+	for _, ident := range idents {
+		names = append(names, ident.Name)
+	}
+
+	return strings.Join(names, ", ")
+}
+
+/*
+addParam 引数を追加する
+識別子の引数(isIdent)は元の名前を使うが、他の引数と重なる場合は数字を付ける
+*/
+func (e *extraction) addParam(key string, name string, isIdent bool, typ ast.Expr, args []ast.Expr) *extractParam {
+	param := &extractParam{
+		name:    name,
+		args:    args,
+		objects: make([]*ast.Object, len(args)),
+	}
+	for _, other := range e.paramList {
+		if other.name == param.name {
+			param.name = e.uniqueName(name)
+			break
+		}
+	}
+	if _, ok := e.usedNames[param.name]; ok && !isIdent {
+		param.name = e.uniqueName(name)
+	}
+	e.usedNames[param.name] = struct{}{}
+	param.typ = e.typeOrAny(typ, param.name)
+
+	e.params[key] = param
+	e.paramList = append(e.paramList, param)
+
+	return param
+}
+
+// typeOrAny 推測できなかった型(nil)をanyにし、nameを型の分からないものとして記録する
+func (e *extraction) typeOrAny(typ ast.Expr, name string) ast.Expr {
+	if typ != nil {
+		return typ
+	}
+
+	e.unknownTypes = append(e.unknownTypes, name)
+
+	return ast.NewIdent("any")
+}
+
+/*
+unknownTypesComment 型を推測できなかった引数・戻り値を示す、抽出した関数の前に置くコメント
+anyのままではコンパイルできないことがあるので、正しい型に置き換えるよう促す
+*/
+func (e *extraction) unknownTypesComment() string {
+	if len(e.unknownTypes) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("// TODO: the types of %s are unknown and written as any\n", strings.Join(e.unknownTypes, ", "))
+}
+
+// uniqueName コード片中の名前や他の引数と重ならない名前
+func (e *extraction) uniqueName(name string) string {
+	if _, ok := e.usedNames[name]; !ok {
+		return name
+	}
+
+	for i := 2; ; i++ {
+		candidate := name + strconv.Itoa(i)
+		if _, ok := e.usedNames[candidate]; !ok {
+			return candidate
+		}
+	}
+}
+
+// contains i番目のコード片に位置posが含まれるか
+func (e *extraction) contains(i int, pos token.Pos) bool {
+	return pos.IsValid() && e.nodes[i].Pos() <= pos && pos < e.nodes[i].End()
+}
+
+// containsFunc i番目のコード片を含む関数宣言に位置posが含まれるか
+func (e *extraction) containsFunc(i int, pos token.Pos) bool {
+	return pos.IsValid() && e.funcs[i] != nil && e.funcs[i].Pos() <= pos && pos < e.funcs[i].End()
+}
+
+func declPos(object *ast.Object) token.Pos {
+	if node, ok := object.Decl.(ast.Node); ok {
+		return node.Pos()
+	}
+
+	return token.NoPos
+}
+
+/*
+collectResults コード片の後で使われる変数を戻り値にする
+コード片内で宣言された変数と、コード片内で代入される引数の変数が対象になる
+*/
+func (e *extraction) collectResults() ([]*extractResult, error) {
+	results := []*extractResult{}
+	for _, object := range e.declaredObjects {
+		objects := e.objects[object]
+		if !e.anyUsedAfter(objects) {
+			continue
+		}
+
+		typ, err := e.commonType(objects)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, &extractResult{
+			name:     object.Name,
+			objects:  objects,
+			typ:      typ,
+			declared: true,
+		})
+	}
+
+	for _, param := range e.paramList {
+		if param.objects[0] == nil || param.objects[0].Kind != ast.Var || !e.anyAssigned(param.objects) || !e.anyUsedAfter(param.objects) {
+			continue
+		}
+
+		results = append(results, &extractResult{
+			name:    param.name,
+			objects: param.objects,
+			typ:     param.typ,
+		})
+	}
+
+	return results, nil
+}
+
+// anyUsedAfter いずれかのコード片で、対応する変数がコード片の後に使われているか
+func (e *extraction) anyUsedAfter(objects []*ast.Object) bool {
+	for i, object := range objects {
+		if e.usedAfter(i, object) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// anyAssigned いずれかのコード片で、対応する変数に代入しているか
+func (e *extraction) anyAssigned(objects []*ast.Object) bool {
+	for i, object := range objects {
+		if e.assigned(i, object) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// usedAfter i番目のコード片を含む関数で、コード片の後にobjectが使われているか
+func (e *extraction) usedAfter(i int, object *ast.Object) bool {
+	if e.funcs[i] == nil || object == nil {
+		return false
+	}
+
+	var used bool
+	ast.Inspect(e.funcs[i], func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok && ident.Obj == object && ident.Pos() >= e.nodes[i].End() {
+			used = true
+		}
+
+		return !used
+	})
+
+	return used
+}
+
+// assigned i番目のコード片でobjectに代入しているか
+func (e *extraction) assigned(i int, object *ast.Object) bool {
+	isObject := func(expr ast.Expr) bool {
+		ident, ok := expr.(*ast.Ident)
+		return ok && ident.Obj == object
+	}
+
+	var assigned bool
+	ast.Inspect(e.nodes[i], func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range node.Lhs {
+				assigned = assigned || isObject(lhs)
+			}
+		case *ast.IncDecStmt:
+			assigned = assigned || isObject(node.X)
+		case *ast.RangeStmt:
+			assigned = assigned || (node.Tok == token.ASSIGN && (isObject(node.Key) || isObject(node.Value)))
+		case *ast.UnaryExpr:
+			// ポインタを取られた場合は代入されるかもしれない
+			assigned = assigned || (node.Op == token.AND && isObject(node.X))
+		}
+
+		return !assigned
+	})
+
+	return assigned
+}
+
+/*
+escapes 文のコード片から外に制御が移るか
+return・break・continue・gotoで外に移るものと、外の関数が終わるときに実行されるdeferを含むもののほか、
+コード片の外からgoto・break・continueで移ってくるラベルを含むものも関数にできない
+funcDeclはコード片を含む関数宣言で、nilの場合はラベルを含むだけで外に移るものとする
+*/
+func escapes(root ast.Node, funcDecl *ast.FuncDecl) bool {
+	// コード片内で宣言されたラベル
+	labels := map[string]struct{}{}
+	ast.Inspect(root, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			// 関数リテラルのラベルはその中でしか使えない
+			return false
+		case *ast.LabeledStmt:
+			labels[node.Label.Name] = struct{}{}
+		}
+
+		return true
+	})
+	if len(labels) > 0 && (funcDecl == nil || labelTargeted(funcDecl.Body, root, labels)) {
+		return true
+	}
+
+	var escaped bool
+	// コード片内の、breakやcontinueの対象になる文
+	stack := []ast.Node{}
+	var inspect func(node ast.Node) bool
+	inspect = func(node ast.Node) bool {
+		if escaped {
+			return false
+		}
+
+		switch node := node.(type) {
+		case nil:
+			stack = stack[:len(stack)-1]
+			return false
+		case *ast.FuncLit:
+			// 関数リテラル内のreturnやdeferは外に出ない
+			return false
+		case *ast.ReturnStmt, *ast.DeferStmt:
+			escaped = true
+		case *ast.BranchStmt:
+			if node.Label != nil {
+				_, ok := labels[node.Label.Name]
+				escaped = !ok
+			} else {
+				escaped = !hasTarget(stack, node.Tok)
+			}
+		}
+
+		stack = append(stack, node)
+
+		return true
+	}
+	ast.Inspect(root, inspect)
+
+	return escaped
+}
+
+// labelTargeted bodyのうちrootの外から、labelsのラベルへgoto・break・continueしているか
+func labelTargeted(body *ast.BlockStmt, root ast.Node, labels map[string]struct{}) bool {
+	if body == nil {
+		return false
+	}
+
+	var targeted bool
+	ast.Inspect(body, func(node ast.Node) bool {
+		if targeted || node == root {
+			return false
+		}
+
+		if branch, ok := node.(*ast.BranchStmt); ok && branch.Label != nil {
+			_, targeted = labels[branch.Label.Name]
+		}
+
+		return true
+	})
+
+	return targeted
+}
+
+// callsRecover コード片が、関数リテラルの外でrecoverを呼ぶか
+func callsRecover(root ast.Node) bool {
+	var called bool
+	ast.Inspect(root, func(node ast.Node) bool {
+		if called {
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.FuncLit:
+			// 関数リテラルはコード片と一緒に移るので、その中のrecoverはそのまま働く
+			return false
+		case *ast.CallExpr:
+			// recoverはdeferされた関数から直接呼ばれたときだけ働くので、別の関数に移すと働かなくなる
+			// 他のファイルでrecoverを宣言している場合も組み込みのものとみなし、抽出しない側に倒す
+			ident, ok := node.Fun.(*ast.Ident)
+			called = ok && ident.Name == "recover" && ident.Obj == nil
+		}
+
+		return !called
+	})
+
+	return called
+}
+
+// hasTarget 外側の文にbreak・continue・fallthroughの対象があるか
+func hasTarget(stack []ast.Node, tok token.Token) bool {
+	for _, node := range stack {
+		switch node.(type) {
+		case *ast.ForStmt, *ast.RangeStmt:
+			return true
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			if tok == token.BREAK {
+				return true
+			}
+		case *ast.CaseClause:
+			if tok == token.FALLTHROUGH {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// extractStmt 文のコード片を、後で使う変数を返す関数にする
+func (e *extraction) extractStmt() error {
+	for i, node := range e.nodes {
+		if escapes(node, e.funcs[i]) {
+			return fmt.Errorf("%w: control flow crosses the boundary of the clone", ErrNotExtractable)
+		}
+	}
+
+	e.body = e.nodes[0]
+	body := copyAST(e.nodes[0], e.replace).(ast.Stmt)
+	stmts := []ast.Stmt{body}
+	if block, ok := body.(*ast.BlockStmt); ok {
+		stmts = block.List
+		e.bodyInner = true
+	}
+
+	results, err := e.collectResults()
+	if err != nil {
+		return err
+	}
+	var resultFields *ast.FieldList
+	if len(results) > 0 {
+		resultFields = &ast.FieldList{}
+		returnStmt := &ast.ReturnStmt{}
+		for _, result := range results {
+			typ := e.typeOrAny(result.typ, "result "+result.name)
+			e.resultTypes = append(e.resultTypes, typ)
+
+			resultFields.List = append(resultFields.List, &ast.Field{Type: copyAST(typ, e.replace).(ast.Expr)})
+			returnStmt.Results = append(returnStmt.Results, ast.NewIdent(result.name))
+		}
+		stmts = append(stmts, returnStmt)
+		e.tail = returnStmt
+	}
+
+	e.function = &ast.FuncDecl{
+		Name: ast.NewIdent(e.name),
+		Type: &ast.FuncType{
+			Params:  e.paramFields(),
+			Results: resultFields,
+		},
+		Body: &ast.BlockStmt{List: stmts},
+	}
+
+	for i := range e.nodes {
+		call := e.call(i, nil)
+		assign := &ast.AssignStmt{
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{call},
+		}
+		// このコード片の後で使わない戻り値は、代入だけの未使用の変数にならないように捨てる
+		var used bool
+		for _, result := range results {
+			name := "_"
+			if e.usedAfter(i, result.objects[i]) {
+				name = result.objects[i].Name
+				used = true
+				if result.declared {
+					assign.Tok = token.DEFINE
+				}
+			}
+			assign.Lhs = append(assign.Lhs, ast.NewIdent(name))
+		}
+
+		if !used {
+			e.replacements = append(e.replacements, &ast.ExprStmt{X: call})
+			continue
+		}
+		e.replacements = append(e.replacements, assign)
+	}
+
+	return nil
+}
+
+// extractExpr 式のコード片を、その値を返す関数にする
+func (e *extraction) extractExpr() error {
+	typ := e.typeOrAny(inferType(e.nodes[0].(ast.Expr), 0), "the result")
+	e.resultTypes = []ast.Expr{typ}
+
+	e.body = e.nodes[0]
+	e.bodyReturn = true
+	e.function = &ast.FuncDecl{
+		Name: ast.NewIdent(e.name),
+		Type: &ast.FuncType{
+			Params: e.paramFields(),
+			Results: &ast.FieldList{
+				List: []*ast.Field{{Type: copyAST(typ, e.replace).(ast.Expr)}},
+			},
+		},
+		Body: &ast.BlockStmt{
+			List: []ast.Stmt{
+				&ast.ReturnStmt{Results: []ast.Expr{copyAST(e.nodes[0], e.replace).(ast.Expr)}},
+			},
+		},
+	}
+
+	for i := range e.nodes {
+		e.replacements = append(e.replacements, e.call(i, nil))
+	}
+
+	return nil
+}
+
+/*
+extractFuncDecl 関数全体のコード片を、元の引数と異なる部分の引数を取る関数にする
+元の関数は、抽出した関数を呼ぶだけの関数に置き換える
+*/
+func (e *extraction) extractFuncDecl(funcDecl *ast.FuncDecl) error {
+	if funcDecl.Type.TypeParams != nil {
+		return fmt.Errorf("%w: generic functions are not supported", ErrNotExtractable)
+	}
+
+	// 元の関数の引数(メソッドの場合はレシーバーを先頭にする)を、抽出した関数にそのまま渡す
+	forwarded := make([][]ast.Expr, len(e.nodes))
+	var ellipsis bool
+	fields := []*ast.Field{}
+	for i, node := range e.nodes {
+		funcDecl := node.(*ast.FuncDecl)
+		lists := []*ast.FieldList{funcDecl.Recv, funcDecl.Type.Params}
+		for _, list := range lists {
+			if list == nil {
+				continue
+			}
+
+			for _, field := range list.List {
+				if len(field.Names) == 0 {
+					return fmt.Errorf("%w: unnamed parameters cannot be forwarded", ErrNotExtractable)
+				}
+
+				for _, name := range field.Names {
+					if name.Name == "_" {
+						return fmt.Errorf("%w: blank parameters cannot be forwarded", ErrNotExtractable)
+					}
+					forwarded[i] = append(forwarded[i], ast.NewIdent(name.Name))
+				}
+
+				if i == 0 {
+					fields = append(fields, copyAST(field, e.replace).(*ast.Field))
+				}
+				_, ellipsis = field.Type.(*ast.Ellipsis)
+			}
+		}
+	}
+
+	e.body = funcDecl.Body
+	e.bodyInner = true
+	e.function = &ast.FuncDecl{
+		Name: ast.NewIdent(e.name),
+		Type: &ast.FuncType{
+			Params:  &ast.FieldList{List: fields},
+			Results: copyAST(funcDecl.Type.Results, e.replace).(*ast.FieldList),
+		},
+		Body: copyAST(funcDecl.Body, e.replace).(*ast.BlockStmt),
+	}
+	// 可変長引数は最後に置く必要があるので、異なる部分の引数はその前に入れる
+	extraFields := e.paramFields().List
+	if ellipsis {
+		last := len(fields) - 1
+		e.function.Type.Params.List = append(append(fields[:last:last], extraFields...), fields[last])
+	} else {
+		e.function.Type.Params.List = append(fields, extraFields...)
+	}
+
+	if funcDecl.Type.Results != nil {
+		for _, field := range funcDecl.Type.Results.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				e.resultTypes = append(e.resultTypes, field.Type)
+			}
+		}
+	}
+
+	for i, node := range e.nodes {
+		funcDecl := node.(*ast.FuncDecl)
+		call := e.call(i, forwarded[i])
+		if ellipsis {
+			last := len(forwarded[i]) - 1
+			call.Args = append(append(append([]ast.Expr{}, forwarded[i][:last]...), e.args(i)...), forwarded[i][last])
+			// 位置が無効だと...が出力されないので、仮の位置を入れる
+			call.Ellipsis = 1
+		}
+
+		var stmt ast.Stmt = &ast.ExprStmt{X: call}
+		if funcDecl.Type.Results != nil {
+			stmt = &ast.ReturnStmt{Results: []ast.Expr{call}}
+		}
+
+		e.replacements = append(e.replacements, &ast.FuncDecl{
+			Recv: copyAST(funcDecl.Recv, nil).(*ast.FieldList),
+			Name: ast.NewIdent(funcDecl.Name.Name),
+			Type: copyAST(funcDecl.Type, nil).(*ast.FuncType),
+			Body: &ast.BlockStmt{List: []ast.Stmt{stmt}},
+		})
+	}
+
+	return nil
+}
+
+func (e *extraction) paramFields() *ast.FieldList {
+	fields := &ast.FieldList{}
+	for _, param := range e.paramList {
+		fields.List = append(fields.List, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(param.name)},
+			Type:  copyAST(param.typ, e.replace).(ast.Expr),
+		})
+	}
+
+	return fields
+}
+
+// args i番目のコード片の呼び出しで、異なる部分の引数に渡す式
+func (e *extraction) args(i int) []ast.Expr {
+	args := make([]ast.Expr, 0, len(e.paramList))
+	for _, param := range e.paramList {
+		args = append(args, copyAST(param.args[i], nil).(ast.Expr))
+	}
+
+	return args
+}
+
+// call i番目のコード片を置き換える、抽出した関数の呼び出し
+func (e *extraction) call(i int, forwarded []ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun:  ast.NewIdent(e.name),
+		Args: append(append([]ast.Expr{}, forwarded...), e.args(i)...),
+	}
+}
+
+func literalParamName(kind token.Token) string {
+	switch kind {
+	case token.INT:
+		return "n"
+	case token.FLOAT:
+		return "f"
+	case token.IMAG:
+		return "c"
+	case token.CHAR:
+		return "r"
+	}
+
+	return "s"
+}
+
+func literalType(kind token.Token) ast.Expr {
+	switch kind {
+	case token.INT:
+		return ast.NewIdent("int")
+	case token.FLOAT:
+		return ast.NewIdent("float64")
+	case token.IMAG:
+		return ast.NewIdent("complex128")
+	case token.CHAR:
+		return ast.NewIdent("rune")
+	}
+
+	return ast.NewIdent("string")
+}
+
+// maxInferDepth 変数の初期化の式を辿って型を推測する深さの上限
+const maxInferDepth = 8
+
+// objectType 宣言から分かる範囲でobjectの型を推測する(他のファイルで宣言されたものなど、分からない場合はnil)
+func objectType(object *ast.Object, depth int) ast.Expr {
+	if object == nil || depth > maxInferDepth {
+		return nil
+	}
+
+	switch decl := object.Decl.(type) {
+	case *ast.Field:
+		return decl.Type
+	case *ast.FuncDecl:
+		return decl.Type
+	case *ast.ValueSpec:
+		if decl.Type != nil {
+			return decl.Type
+		}
+
+		for i, name := range decl.Names {
+			if name.Name == object.Name && len(decl.Values) == len(decl.Names) {
+				return inferType(decl.Values[i], depth+1)
+			}
+		}
+	case *ast.AssignStmt:
+		// rangeで宣言された変数は、範囲の式を右辺に持つ代入文が宣言になる
+		if len(decl.Rhs) == 1 {
+			if unary, ok := decl.Rhs[0].(*ast.UnaryExpr); ok && unary.Op == token.RANGE {
+				return rangeType(decl, object, unary.X, depth)
+			}
+		}
+
+		for i, lhs := range decl.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok && ident.Name == object.Name && len(decl.Rhs) == len(decl.Lhs) {
+				return inferType(decl.Rhs[i], depth+1)
+			}
+		}
+	}
+
+	return nil
+}
+
+/*
+commonType 各コード片で対応する変数の型を推測する(分からない場合はnil)
+型の分かるコード片の間で型が異なる場合は、genericなら型パラメータを使った型にし、そうでなければErrNotExtractableを返す
+*/
+func (e *extraction) commonType(objects []*ast.Object) (ast.Expr, error) {
+	types := make([]ast.Expr, 0, len(objects))
+	var typ ast.Expr
+	var typeSrc string
+	var differ bool
+	for _, object := range objects {
+		objectTyp := objectType(object, 0)
+		types = append(types, objectTyp)
+		if objectTyp == nil {
+			continue
+		}
+
+		src := formatNode(objectTyp)
+		if typ == nil {
+			typ, typeSrc = objectTyp, src
+			continue
+		}
+
+		if src != typeSrc {
+			if !e.generic {
+				return nil, fmt.Errorf("%w: types of %s differ (%s, %s)", ErrNotExtractable, objects[0].Name, typeSrc, src)
+			}
+			differ = true
+		}
+	}
+
+	if differ {
+		return e.generalizeType(objects[0].Name, types)
+	}
+
+	return typ, nil
+}
+
+// rangeType rangeで宣言された変数の型を、範囲の式の型から推測する
+func rangeType(decl *ast.AssignStmt, object *ast.Object, x ast.Expr, depth int) ast.Expr {
+	isValue := len(decl.Lhs) == 2
+	if ident, ok := decl.Lhs[0].(*ast.Ident); ok && ident.Name == object.Name {
+		isValue = false
+	}
+
+	switch typ := inferType(x, depth+1).(type) {
+	case *ast.ArrayType:
+		if isValue {
+			return typ.Elt
+		}
+		return ast.NewIdent("int")
+	case *ast.MapType:
+		if isValue {
+			return typ.Value
+		}
+		return typ.Key
+	case *ast.Ident:
+		if typ.Name == "string" {
+			if isValue {
+				return ast.NewIdent("rune")
+			}
+			return ast.NewIdent("int")
+		}
+	}
+
+	return nil
+}
+
+// inferType 式の形から分かる範囲で型を推測する(分からない場合はnil)
+func inferType(expr ast.Expr, depth int) ast.Expr {
+	if depth > maxInferDepth {
+		return nil
+	}
+
+	switch expr := expr.(type) {
+	case *ast.BasicLit:
+		return literalType(expr.Kind)
+	case *ast.CompositeLit:
+		return expr.Type
+	case *ast.ParenExpr:
+		return inferType(expr.X, depth+1)
+	case *ast.UnaryExpr:
+		switch expr.Op {
+		case token.AND:
+			if typ := inferType(expr.X, depth+1); typ != nil {
+				return &ast.StarExpr{X: typ}
+			}
+		case token.NOT:
+			return ast.NewIdent("bool")
+		case token.ARROW:
+			return nil
+		default:
+			return inferType(expr.X, depth+1)
+		}
+	case *ast.BinaryExpr:
+		switch expr.Op {
+		case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ, token.LAND, token.LOR:
+			return ast.NewIdent("bool")
+		case token.SHL, token.SHR:
+			return inferType(expr.X, depth+1)
+		}
+
+		if typ := inferType(expr.X, depth+1); typ != nil {
+			return typ
+		}
+		return inferType(expr.Y, depth+1)
+	case *ast.CallExpr:
+		if ident, ok := expr.Fun.(*ast.Ident); ok && ident.Obj == nil && len(expr.Args) > 0 {
+			switch ident.Name {
+			case "make":
+				return expr.Args[0]
+			case "new":
+				return &ast.StarExpr{X: expr.Args[0]}
+			}
+		}
+	case *ast.Ident:
+		if expr.Obj == nil {
+			if expr.Name == "true" || expr.Name == "false" {
+				return ast.NewIdent("bool")
+			}
+			return nil
+		}
+
+		if expr.Obj.Kind == ast.Var || expr.Obj.Kind == ast.Con {
+			return objectType(expr.Obj, depth+1)
+		}
+	}
+
+	return nil
+}
+
+// formatNode 複製したASTをgo/formatで整形する
+func formatNode(node ast.Node) string {
+	if node == nil {
+		return ""
+	}
+
+	copied := copyAST(node, nil)
+	// 位置情報がないと空の構造体・インターフェースが複数行で出力されるので、括弧を同じ行に置く
+	ast.Inspect(copied, func(node ast.Node) bool {
+		var fields *ast.FieldList
+		switch node := node.(type) {
+		case *ast.StructType:
+			fields = node.Fields
+		case *ast.InterfaceType:
+			fields = node.Methods
+		}
+		if fields != nil && len(fields.List) == 0 {
+			fields.Opening, fields.Closing = 1, 1
+		}
+
+		return true
+	})
+
+	var buf bytes.Buffer
+	err := format.Node(&buf, token.NewFileSet(), copied)
+	if err != nil {
+		return fmt.Sprintf("/* %v */", err)
+	}
+
+	return buf.String()
+}
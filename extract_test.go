@@ -0,0 +1,362 @@
+package clone_test
+
+import (
+	"errors"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// suggestExtraction a.goのline1行目とb.goのline2行目から始まるクローンを関数にまとめる提案を作る
+func suggestExtraction(t *testing.T, src1 string, line1 int, src2 string, line2 int) (*clone.ExtractSuggestion, error) {
+	t.Helper()
+
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", src1},
+		source{"b.go", src2},
+	)
+
+	clonePairs := getClones(t, cd)
+	clonePair := findClone(clonePairs, "a.go", line1, "b.go", line2)
+	if clonePair == nil {
+		t.Fatalf("clone at a.go:%d and b.go:%d not found: %v", line1, line2, clonePairStrings(clonePairs))
+	}
+
+	return cd.SuggestExtraction(clonePair)
+}
+
+func TestSuggestExtraction(t *testing.T) {
+	suggestion, err := suggestExtraction(t, `package p
+
+func A(values []int) int {
+	println("a")
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`, 6, `package p
+
+func B(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	println("b", n)
+	return n
+}
+`, 5)
+	if err != nil {
+		t.Fatalf("failed to suggest extraction: %v", err)
+	}
+
+	params := []string{}
+	for _, param := range suggestion.Params {
+		params = append(params, param.Name+" "+param.Type+" "+param.Arg1+" "+param.Arg2)
+	}
+	assertSameLines(t, []string{"values []int values items", "total int total n"}, params)
+
+	expected := `func extracted(values []int, total int) int {
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}`
+	if suggestion.Function != expected {
+		t.Errorf("unexpected function:\nexpected\n%s\nactual\n%s", expected, suggestion.Function)
+	}
+	if suggestion.Replacement1 != "total = extracted(values, total)" || suggestion.Replacement2 != "n = extracted(items, n)" {
+		t.Errorf("unexpected replacements: %q, %q", suggestion.Replacement1, suggestion.Replacement2)
+	}
+}
+
+func TestSuggestExtractionUnknownType(t *testing.T) {
+	// 他のファイルで宣言された関数の戻り値は型が分からない
+	suggestion, err := suggestExtraction(t, `package p
+
+func A() int {
+	values := loadValues()
+	println("a")
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`, 7, `package p
+
+func B() int {
+	items := loadItems()
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	println("b", n)
+	return n
+}
+`, 6)
+	if err != nil {
+		t.Fatalf("failed to suggest extraction: %v", err)
+	}
+
+	assertSameLines(t, []string{"values"}, suggestion.UnknownTypes)
+
+	expected := `// TODO: the types of values are unknown and written as any
+func extracted(values any, total int) int {
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}`
+	if suggestion.Function != expected {
+		t.Errorf("unexpected function:\nexpected\n%s\nactual\n%s", expected, suggestion.Function)
+	}
+}
+
+func TestSuggestExtractionLabelInside(t *testing.T) {
+	// コード片内のラベルへのcontinueはそのまま関数に移せる
+	_, err := suggestExtraction(t, `package p
+
+func A(rows [][]int) int {
+	println("a")
+	total := 0
+outer:
+	for _, row := range rows {
+		for _, value := range row {
+			if value < 0 {
+				continue outer
+			}
+			total += value
+		}
+	}
+	return total
+}
+`, 6, `package p
+
+func B(rows [][]int) int {
+	n := 0
+outer:
+	for _, row := range rows {
+		for _, value := range row {
+			if value < 0 {
+				continue outer
+			}
+			n += value
+		}
+	}
+	println("b", n)
+	return n
+}
+`, 5)
+	if err != nil {
+		t.Errorf("failed to suggest extraction: %v", err)
+	}
+}
+
+func TestSuggestExtractionNotExtractable(t *testing.T) {
+	cases := []struct {
+		name         string
+		src1, src2   string
+		line1, line2 int
+	}{
+		{
+			name: "return",
+			src1: `package p
+
+func A(values []int) int {
+	println("a")
+	total := 0
+	for _, value := range values {
+		if value < 0 {
+			return -1
+		}
+		total += value
+	}
+	return total
+}
+`,
+			line1: 6,
+			src2: `package p
+
+func B(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item < 0 {
+			return -1
+		}
+		n += item
+	}
+	println("b", n)
+	return n
+}
+`,
+			line2: 5,
+		},
+		{
+			name: "break out of the clone",
+			src1: `package p
+
+func A(values []int) int {
+	total := 0
+	for _, value := range values {
+		println("a")
+		if value > 0 {
+			total += value * 2
+			total *= 3
+			break
+		}
+	}
+	return total
+}
+`,
+			line1: 7,
+			src2: `package p
+
+func B(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item * 2
+			n *= 3
+			break
+		}
+		println("b")
+	}
+	return n
+}
+`,
+			line2: 6,
+		},
+		{
+			// deferは抽出した関数が終わるときに実行されてしまう
+			name: "defer",
+			src1: `package p
+
+func A(m *sync.Mutex, values []int) int {
+	println("a")
+	total := 0
+	if len(values) > 0 {
+		m.Lock()
+		defer m.Unlock()
+		for _, value := range values {
+			total += value
+		}
+	}
+	return total
+}
+`,
+			line1: 6,
+			src2: `package p
+
+func B(m *sync.Mutex, items []int) int {
+	n := 0
+	if len(items) > 0 {
+		m.Lock()
+		defer m.Unlock()
+		for _, item := range items {
+			n += item
+		}
+	}
+	println("b", n)
+	return n
+}
+`,
+			line2: 5,
+		},
+		{
+			// recoverはdeferされた関数から直接呼ばないと働かない
+			name: "recover",
+			src1: `package p
+
+func A() (err error) {
+	defer func() {
+		println("a")
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return run()
+}
+`,
+			line1: 6,
+			src2: `package p
+
+func B() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+		println("b")
+	}()
+	return run()
+}
+`,
+			line2: 5,
+		},
+		{
+			// コード片の外のgotoの移り先になっている
+			name: "labeled statement targeted from outside",
+			src1: `package p
+
+func A(values []int) int {
+	println("a")
+	total := 0
+	attempts := 0
+retry:
+	for _, value := range values {
+		total += value * attempts
+	}
+	attempts++
+	if total < 0 && attempts < 3 {
+		total = 0
+		goto retry
+	}
+	return total
+}
+`,
+			line1: 7,
+			src2: `package p
+
+func B(items []int) int {
+	n := 0
+	attempts := 0
+retry:
+	for _, item := range items {
+		n += item * attempts
+	}
+	println("b", n)
+	attempts++
+	if n < 0 && attempts < 3 {
+		n = 0
+		goto retry
+	}
+	return n
+}
+`,
+			line2: 6,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			suggestion, err := suggestExtraction(t, c.src1, c.line1, c.src2, c.line2)
+			if !errors.Is(err, clone.ErrNotExtractable) {
+				t.Errorf("unexpected result: %v, %v", suggestion, err)
+			}
+		})
+	}
+}
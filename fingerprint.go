@@ -0,0 +1,32 @@
+package clone
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+)
+
+/*
+fingerprint 正規化されたノード列から、位置に依存しないハッシュを作る
+同じ構造のコード片は、どのファイルのどの位置にあっても同じ値になる
+*/
+func fingerprint(nodes []*domain.Node) string {
+	hash := sha256.New()
+	buf := make([]byte, 2+2*binary.MaxVarintLen64)
+	for _, node := range nodes {
+		buf[0] = byte(node.GetNodeType())
+		buf[1] = byte(node.GetToken())
+		n := 2
+		n += binary.PutVarint(buf[n:], int64(node.GetChildCount()))
+		// 識別子名などを比較しない場合は値が常に0なので、以前と同じハッシュになるよう書き込まない
+		if value := node.GetValue(); value != values.NodeValueNone {
+			n += binary.PutUvarint(buf[n:], uint64(value))
+		}
+		hash.Write(buf[:n])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)[:16])
+}
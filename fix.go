@@ -0,0 +1,501 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+	"github.com/mazrean/go-clone-detection/serializer"
+)
+
+var (
+	ErrNotSharable  = errors.New("clones are in different packages and cannot share a helper function")
+	ErrFileModified = errors.New("file has been modified since it was added")
+)
+
+// FixedFile クローンを1つの関数にまとめるために書き換えたファイル
+type FixedFile struct {
+	Filename string
+	// 書き換える前と後のソースコード
+	Src   []byte
+	Fixed []byte
+}
+
+// edit ソースコードの[start, end)をtextに置き換える
+type edit struct {
+	start, end int
+	text       string
+}
+
+/*
+FixCloneClass クローンクラスの全てのコード片を、新しく作った関数の呼び出しに置き換えたソースコードを返す
+関数は先頭のコード片を含むファイルに追加し、使わなくなったimportを消して、足りないimportを他のコード片のファイルから補う
+ファイルは書き換えないので、戻り値を書き込むか差分として表示する
+コード片が同じパッケージにない場合はErrNotSharable、関数にまとめられない場合や引数・戻り値の型が分からない場合はErrNotExtractable、
+追加した後にコード片のファイルが書き換えられている場合はErrFileModifiedを返す
+*/
+func (cd *CloneDetector) FixCloneClass(cloneClass *CloneClass) ([]*FixedFile, error) {
+	if len(cloneClass.Nodes) < 2 {
+		return nil, fmt.Errorf("%w: clone class has less than 2 fragments", ErrNotExtractable)
+	}
+
+	tokenFiles := make([]*token.File, 0, len(cloneClass.Nodes))
+	for _, node := range cloneClass.Nodes {
+		if node == nil {
+			// 連続して並ぶ文をまとめたコード片や、LoadIndexで読み込んだままのファイルのコード片
+			return nil, fmt.Errorf("%w: fragment is not a single subtree with an AST", ErrNotExtractable)
+		}
+
+		tokenFile := cd.fset.File(node.Pos())
+		if _, ok := cd.astFiles[tokenFile]; !ok {
+			return nil, fmt.Errorf("%w: %s was not added as a file", ErrNotExtractable, cd.fset.Position(node.Pos()).Filename)
+		}
+		tokenFiles = append(tokenFiles, tokenFile)
+	}
+
+	packageFiles, err := cd.packageFiles(tokenFiles)
+	if err != nil {
+		return nil, err
+	}
+
+	// 抽出した関数の名前がパッケージ内の宣言と重ならないようにする
+	reservedNames := []string{}
+	for _, file := range packageFiles {
+		for name := range file.Scope.Objects {
+			reservedNames = append(reservedNames, name)
+		}
+	}
+
+	e, err := cd.newExtraction(cloneClass.Nodes, reservedNames, false)
+	if err != nil {
+		return nil, err
+	}
+	// anyのまま書き込むとコンパイルできないことがあるので、書き換えない
+	if len(e.unknownTypes) > 0 {
+		return nil, fmt.Errorf("%w: the types of %s are unknown", ErrNotExtractable, strings.Join(e.unknownTypes, ", "))
+	}
+
+	srcs := map[*token.File][]byte{}
+	fileOrder := []*token.File{}
+	for _, tokenFile := range tokenFiles {
+		if _, ok := srcs[tokenFile]; ok {
+			continue
+		}
+
+		src, err := os.ReadFile(tokenFile.Name())
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if len(src) != tokenFile.Size() || !sameAST(cd.astFiles[tokenFile], tokenFile, src) {
+			return nil, fmt.Errorf("%w: %s", ErrFileModified, tokenFile.Name())
+		}
+
+		srcs[tokenFile] = src
+		fileOrder = append(fileOrder, tokenFile)
+	}
+
+	edits := map[*token.File][]*edit{}
+	for i, node := range cloneClass.Nodes {
+		text := formatNode(e.replacements[i])
+		if _, ok := node.(*ast.BlockStmt); ok {
+			// if文の本体などのブロックはブロックのまま置き換える
+			text = "{\n" + text + "}"
+		}
+
+		edits[tokenFiles[i]] = append(edits[tokenFiles[i]], &edit{
+			start: tokenFiles[i].Offset(node.Pos()),
+			end:   tokenFiles[i].Offset(node.End()),
+			text:  text,
+		})
+	}
+
+	helper, err := e.helperSource(tokenFiles[0], srcs[tokenFiles[0]])
+	if err != nil {
+		return nil, err
+	}
+	// 抽出した関数は先頭のコード片を含む宣言の直後に置く
+	helperOffset := tokenFiles[0].Size()
+	if e.funcs[0] != nil {
+		helperOffset = tokenFiles[0].Offset(e.funcs[0].End())
+	}
+	edits[tokenFiles[0]] = append(edits[tokenFiles[0]], &edit{
+		start: helperOffset,
+		end:   helperOffset,
+		text:  "\n\n" + helper,
+	})
+
+	// 他のコード片のファイルのimportから、足りないimportを補う
+	imports := map[string]string{}
+	for _, tokenFile := range fileOrder {
+		for _, spec := range cd.astFiles[tokenFile].Imports {
+			name, ok := importName(spec)
+			if _, exists := imports[name]; ok && !exists {
+				imports[name] = importSpecSource(spec)
+			}
+		}
+	}
+
+	fixedFiles := make([]*FixedFile, 0, len(fileOrder))
+	for _, tokenFile := range fileOrder {
+		fixed, err := applyEdits(srcs[tokenFile], edits[tokenFile])
+		if err != nil {
+			return nil, fmt.Errorf("%w: fragments overlap in %s", ErrNotExtractable, tokenFile.Name())
+		}
+
+		fixed, err = fixImports(srcs[tokenFile], fixed, imports)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fix imports of %s: %w", tokenFile.Name(), err)
+		}
+
+		fixed, err = format.Source(fixed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to format %s: %w", tokenFile.Name(), err)
+		}
+
+		fixedFiles = append(fixedFiles, &FixedFile{
+			Filename: tokenFile.Name(),
+			Src:      srcs[tokenFile],
+			Fixed:    fixed,
+		})
+	}
+
+	return fixedFiles, nil
+}
+
+/*
+sameAST srcをパースし直したASTが、追加したときのfileと同じか
+コメントを除く全てのノードの種類・位置・トークンと識別子名・リテラルの値を比べるので、
+同じ大きさのまま書き換えられたファイルでも、コード片の位置がずれたり内容が変わったりしていれば違うものとみなす
+*/
+func sameAST(file *ast.File, tokenFile *token.File, src []byte) bool {
+	fset := token.NewFileSet()
+	parsed, err := parser.ParseFile(fset, tokenFile.Name(), src, 0)
+	if err != nil {
+		return false
+	}
+
+	nodes := astNodes(file, tokenFile.Base())
+	parsedNodes := astNodes(parsed, fset.File(parsed.Pos()).Base())
+	if len(nodes) != len(parsedNodes) {
+		return false
+	}
+	for i := range nodes {
+		if nodes[i] != parsedNodes[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// astNode sameASTで比べるノードの内容(位置はファイルの先頭からのオフセット)
+type astNode struct {
+	nodeType   values.NodeType
+	token      values.NodeToken
+	value      values.NodeValue
+	start, end int64
+}
+
+// astNodes fileを識別子名・リテラルの値を区別して直列化したノードのうち、コメント以外のもの
+func astNodes(file *ast.File, base int) []astNode {
+	nodeChan := make(chan *domain.Node)
+	go func() {
+		defer close(nodeChan)
+		_ = serializer.NewSerializer(serializer.ModeIdentifier|serializer.ModeLiteral).Serialize(context.Background(), file, nodeChan)
+	}()
+
+	nodes := []astNode{}
+	for node := range nodeChan {
+		nodeType := node.GetNodeType()
+		if nodeType == values.NodeTypeComment || nodeType == values.NodeTypeCommentGroup {
+			continue
+		}
+
+		position := node.GetPosition()
+		nodes = append(nodes, astNode{
+			nodeType: nodeType,
+			token:    node.GetToken(),
+			value:    node.GetValue(),
+			start:    position.GetStart() - int64(base),
+			end:      position.GetEnd() - int64(base),
+		})
+	}
+
+	return nodes
+}
+
+/*
+packageFiles コード片を含むファイルが全て同じパッケージにあるか確かめ、そのパッケージの追加済みのファイルを返す
+同じディレクトリで同じパッケージ名のファイルを同じパッケージとみなす
+*/
+func (cd *CloneDetector) packageFiles(tokenFiles []*token.File) ([]*ast.File, error) {
+	dir := filepath.Dir(tokenFiles[0].Name())
+	name := cd.astFiles[tokenFiles[0]].Name.Name
+	for _, tokenFile := range tokenFiles[1:] {
+		if filepath.Dir(tokenFile.Name()) != dir || cd.astFiles[tokenFile].Name.Name != name {
+			return nil, fmt.Errorf("%w: %s and %s", ErrNotSharable, tokenFiles[0].Name(), tokenFile.Name())
+		}
+	}
+
+	files := []*ast.File{}
+	for tokenFile, file := range cd.astFiles {
+		if filepath.Dir(tokenFile.Name()) == dir && file.Name.Name == name {
+			files = append(files, file)
+		}
+	}
+
+	return files, nil
+}
+
+/*
+helperSource 抽出した関数のソースコード
+本体は先頭のコード片のソースコードを引数に置き換えて使うので、コメントや改行が残る
+*/
+func (e *extraction) helperSource(tokenFile *token.File, src []byte) (string, error) {
+	body := e.body
+	start, end := tokenFile.Offset(body.Pos()), tokenFile.Offset(body.End())
+
+	edits := []*edit{}
+	for node, replaced := range e.replace {
+		if node.Pos() < body.Pos() || body.End() < node.End() {
+			continue
+		}
+
+		edits = append(edits, &edit{
+			start: tokenFile.Offset(node.Pos()) - start,
+			end:   tokenFile.Offset(node.End()) - start,
+			text:  formatNode(replaced),
+		})
+	}
+
+	bodySrc, err := applyEdits(src[start:end], edits)
+	if err != nil {
+		return "", err
+	}
+
+	bodyText := string(bodySrc)
+	if e.bodyInner {
+		bodyText = bodyText[1 : len(bodyText)-1]
+	}
+	if e.bodyReturn {
+		bodyText = "return " + bodyText
+	}
+	if e.tail != nil {
+		bodyText += "\n" + formatNode(e.tail)
+	}
+
+	header := formatNode(&ast.FuncDecl{
+		Name: e.function.Name,
+		Type: e.function.Type,
+	})
+
+	return strings.TrimSuffix(header, "\n") + " {\n" + strings.Trim(bodyText, "\n") + "\n}\n", nil
+}
+
+// applyEdits srcにeditsを適用する(置き換える範囲が重なる場合はエラーを返す)
+func applyEdits(src []byte, edits []*edit) ([]byte, error) {
+	sorted := make([]*edit, len(edits))
+	copy(sorted, edits)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].start < sorted[j].start
+	})
+
+	fixed := make([]byte, 0, len(src))
+	offset := 0
+	for _, e := range sorted {
+		if e.start < offset {
+			return nil, errors.New("edits overlap")
+		}
+
+		fixed = append(fixed, src[offset:e.start]...)
+		fixed = append(fixed, e.text...)
+		offset = e.end
+	}
+	fixed = append(fixed, src[offset:]...)
+
+	return fixed, nil
+}
+
+/*
+fixImports 書き換えで使わなくなったimportを消し、importsから足りないimportを補う
+型情報を使わずにパスの末尾をパッケージ名とみなすので、元のソースコードで使われていなかった名前のimportは変えない
+*/
+func fixImports(src, fixed []byte, imports map[string]string) ([]byte, error) {
+	fset := token.NewFileSet()
+	srcFile, err := parser.ParseFile(fset, "", src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse source: %w", err)
+	}
+
+	fixedFile, err := parser.ParseFile(fset, "", fixed, 0)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse fixed source: %w", err)
+	}
+
+	srcUsed, fixedUsed := packageNames(srcFile), packageNames(fixedFile)
+	tokenFile := fset.File(fixedFile.Pos())
+
+	edits := []*edit{}
+	imported := map[string]struct{}{}
+	// 足りないimportを追加する宣言(括弧のあるものを優先する)
+	var importDecl *ast.GenDecl
+	for _, decl := range fixedFile.Decls {
+		genDecl, ok := decl.(*ast.GenDecl)
+		if !ok || genDecl.Tok != token.IMPORT {
+			continue
+		}
+		if importDecl == nil || (!importDecl.Lparen.IsValid() && genDecl.Lparen.IsValid()) {
+			importDecl = genDecl
+		}
+
+		var removed int
+		specEdits := []*edit{}
+		for _, spec := range genDecl.Specs {
+			name, ok := importName(spec.(*ast.ImportSpec))
+			if !ok {
+				continue
+			}
+			imported[name] = struct{}{}
+
+			_, used := fixedUsed[name]
+			_, usedBefore := srcUsed[name]
+			if used || !usedBefore {
+				continue
+			}
+
+			removed++
+			specEdits = append(specEdits, lineEdit(tokenFile, fixed, spec.Pos(), spec.End()))
+		}
+
+		switch {
+		case removed == len(genDecl.Specs) && removed > 0:
+			edits = append(edits, lineEdit(tokenFile, fixed, genDecl.Pos(), genDecl.End()))
+			if importDecl == genDecl {
+				importDecl = nil
+			}
+		default:
+			edits = append(edits, specEdits...)
+		}
+	}
+
+	missing := []string{}
+	for name := range fixedUsed {
+		_, ok := imported[name]
+		if _, candidate := imports[name]; !ok && candidate {
+			missing = append(missing, imports[name])
+		}
+	}
+	sort.Strings(missing)
+
+	if len(missing) > 0 {
+		switch {
+		case importDecl != nil && importDecl.Lparen.IsValid():
+			offset := tokenFile.Offset(importDecl.Rparen)
+			edits = append(edits, &edit{
+				start: offset,
+				end:   offset,
+				text:  "\t" + strings.Join(missing, "\n\t") + "\n",
+			})
+		case importDecl != nil:
+			// 括弧のない宣言は括弧で囲んで追加する
+			spec := fixed[tokenFile.Offset(importDecl.Specs[0].Pos()):tokenFile.Offset(importDecl.Specs[0].End())]
+			edits = append(edits, &edit{
+				start: tokenFile.Offset(importDecl.Pos()),
+				end:   tokenFile.Offset(importDecl.End()),
+				text:  "import (\n\t" + string(spec) + "\n\t" + strings.Join(missing, "\n\t") + "\n)",
+			})
+		default:
+			offset := tokenFile.Offset(fixedFile.Name.End())
+			edits = append(edits, &edit{
+				start: offset,
+				end:   offset,
+				text:  "\n\nimport (\n\t" + strings.Join(missing, "\n\t") + "\n)",
+			})
+		}
+	}
+
+	return applyEdits(fixed, edits)
+}
+
+// lineEdit [pos, end)を消す(その行に他に何もない場合は行ごと消す)
+func lineEdit(tokenFile *token.File, src []byte, pos, end token.Pos) *edit {
+	start, stop := tokenFile.Offset(pos), tokenFile.Offset(end)
+	for start > 0 && (src[start-1] == ' ' || src[start-1] == '\t') {
+		start--
+	}
+	for stop < len(src) && (src[stop] == ' ' || src[stop] == '\t') {
+		stop++
+	}
+	if (start == 0 || src[start-1] == '\n') && stop < len(src) && src[stop] == '\n' {
+		stop++
+	}
+
+	return &edit{
+		start: start,
+		end:   stop,
+	}
+}
+
+/*
+packageNames ファイル内でパッケージ名として使われているかもしれない名前
+ファイル内で解決できないセレクタの左辺には他のファイルで宣言された変数も含まれるが、
+パッケージレベルの宣言とimportは同じ名前を持てないので、importの名前と比べる分には区別しなくてよい
+*/
+func packageNames(file *ast.File) map[string]struct{} {
+	names := map[string]struct{}{}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if selector, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := selector.X.(*ast.Ident); ok && ident.Obj == nil {
+				names[ident.Name] = struct{}{}
+			}
+		}
+
+		return true
+	})
+
+	return names
+}
+
+// importName importしたパッケージを参照する名前(ブランク・ドットimportやcgoの場合はfalse)
+func importName(spec *ast.ImportSpec) (string, bool) {
+	importPath, err := strconv.Unquote(spec.Path.Value)
+	if err != nil || importPath == "C" {
+		return "", false
+	}
+
+	if spec.Name != nil {
+		return spec.Name.Name, spec.Name.Name != "_" && spec.Name.Name != "."
+	}
+
+	name := path.Base(importPath)
+	// example.com/foo/v2のようなメジャーバージョンの要素はパッケージ名にならない
+	if len(name) > 1 && name[0] == 'v' && strings.Trim(name[1:], "0123456789") == "" {
+		name = path.Base(path.Dir(importPath))
+	}
+	// gopkg.in/yaml.v3のようなバージョンの付いた要素はその前がパッケージ名になる
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i]
+	}
+
+	return name, true
+}
+
+func importSpecSource(spec *ast.ImportSpec) string {
+	if spec.Name != nil {
+		return spec.Name.Name + " " + spec.Path.Value
+	}
+
+	return spec.Path.Value
+}
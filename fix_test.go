@@ -0,0 +1,215 @@
+package clone_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// newFileDetector sourcesを一時ディレクトリに書き出し、AddFilesで追加したCloneDetectorを作る
+func newFileDetector(t *testing.T, config clone.Config, sources ...source) (*clone.CloneDetector, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	filenames := make([]string, 0, len(sources))
+	for _, s := range sources {
+		filename := filepath.Join(dir, s.filename)
+		err := os.WriteFile(filename, []byte(s.src), 0o644)
+		if err != nil {
+			t.Fatalf("failed to write %s: %v", s.filename, err)
+		}
+		filenames = append(filenames, filename)
+	}
+
+	cd := clone.NewCloneDetector(&config)
+	err := cd.AddFiles(context.Background(), filenames)
+	if err != nil {
+		t.Fatalf("failed to add files: %v", err)
+	}
+
+	return cd, dir
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	src, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", filename, err)
+	}
+
+	return string(src)
+}
+
+// largestCloneClass ノード数が最も多いクローンクラス
+func largestCloneClass(t *testing.T, cd *clone.CloneDetector) *clone.CloneClass {
+	t.Helper()
+
+	cloneClasses, err := cd.GetCloneClasses()
+	if err != nil {
+		t.Fatalf("failed to get clone classes: %v", err)
+	}
+
+	var largest *clone.CloneClass
+	for _, cloneClass := range cloneClasses {
+		if largest == nil || cloneClass.TokenCount > largest.TokenCount {
+			largest = cloneClass
+		}
+	}
+	if largest == nil {
+		t.Fatal("no clone classes found")
+	}
+
+	return largest
+}
+
+func TestFixCloneClassFileModified(t *testing.T) {
+	cases := []struct {
+		name     string
+		old, new string
+		// 書き換えた後もまとめられるか
+		fixable bool
+	}{
+		{
+			name:    "operator changed",
+			old:     "item > 0",
+			new:     "item < 0",
+			fixable: false,
+		},
+		{
+			name:    "identifier renamed",
+			old:     "n := 0",
+			new:     "m := 0",
+			fixable: false,
+		},
+		{
+			name:    "fragment moved",
+			old:     "\tn := 0\n",
+			new:     "n := 0\n\t",
+			fixable: false,
+		},
+		{
+			// コメントだけの書き換えでは、コード片の位置も内容も変わらない
+			name:    "comment edited",
+			old:     "number of items",
+			new:     "number of elems",
+			fixable: true,
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			cd, dir := newFileDetector(t, clone.Config{Threshold: 10},
+				source{"a.go", sumSource},
+				source{"b.go", countSource + "\n// limit is the maximum number of items\nconst limit = 3\n"},
+			)
+			cloneClass := largestCloneClass(t, cd)
+
+			// 大きさの変わらない書き換え
+			filename := filepath.Join(dir, "b.go")
+			src := readFile(t, filename)
+			modified := strings.Replace(src, c.old, c.new, 1)
+			if len(modified) != len(src) {
+				t.Fatalf("modification changes the size: %q", modified)
+			}
+			err := os.WriteFile(filename, []byte(modified), 0o644)
+			if err != nil {
+				t.Fatalf("failed to write file: %v", err)
+			}
+
+			_, err = cd.FixCloneClass(cloneClass)
+			if c.fixable && err != nil {
+				t.Errorf("failed to fix clone class: %v", err)
+			}
+			if !c.fixable && !errors.Is(err, clone.ErrFileModified) {
+				t.Errorf("unexpected error fixing a modified file: %v", err)
+			}
+		})
+	}
+}
+
+func TestFixCloneClassDefer(t *testing.T) {
+	// deferを含む文を関数に移すと、deferが実行される時点が変わる
+	cd, _ := newFileDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", `package p
+
+func A(m *sync.Mutex, values []int) int {
+	println("a")
+	total := 0
+	if len(values) > 0 {
+		m.Lock()
+		defer m.Unlock()
+		for _, value := range values {
+			total += value
+		}
+	}
+	return total
+}
+`},
+		source{"b.go", `package p
+
+func B(m *sync.Mutex, items []int) int {
+	n := 0
+	if len(items) > 0 {
+		m.Lock()
+		defer m.Unlock()
+		for _, item := range items {
+			n += item
+		}
+	}
+	println("b", n)
+	return n
+}
+`},
+	)
+
+	fixedFiles, err := cd.FixCloneClass(largestCloneClass(t, cd))
+	if !errors.Is(err, clone.ErrNotExtractable) {
+		t.Errorf("unexpected result fixing a clone with defer: %d files, %v", len(fixedFiles), err)
+	}
+}
+
+func TestFixCloneClassUnknownType(t *testing.T) {
+	// 他のファイルで宣言された関数の戻り値の型は分からないので、anyのまま書き込まない
+	cd, dir := newFileDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", `package p
+
+func A() int {
+	values := loadValues()
+	println("a")
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`},
+		source{"b.go", `package p
+
+func B() int {
+	items := loadItems()
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	println("b", n)
+	return n
+}
+`},
+	)
+
+	fixedFiles, err := cd.FixCloneClass(largestCloneClass(t, cd))
+	if !errors.Is(err, clone.ErrNotExtractable) || !strings.Contains(err.Error(), "values") {
+		t.Errorf("unexpected result fixing a clone with unknown types in %s: %d files, %v", dir, len(fixedFiles), err)
+	}
+}
@@ -0,0 +1,51 @@
+package clone
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+
+	"github.com/mazrean/go-clone-detection/domain"
+)
+
+// Fragment クローンを構成するコード片の位置情報
+type Fragment struct {
+	Filename    string
+	StartLine   int
+	StartColumn int
+	EndLine     int
+	EndColumn   int
+	// コード片に含まれるASTノード数
+	TokenCount int
+	// コード片を構成する部分木の根(ソースコード上の順)
+	Nodes []ast.Node
+}
+
+func newFragment(fset *token.FileSet, node *domain.Node) *Fragment {
+	return newSequenceFragment(fset, []*domain.Node{node}, int(node.GetChildCount())+1)
+}
+
+// newSequenceFragment 帰りがけ順に並んだ部分木の根から、それらを覆うコード片を作る
+func newSequenceFragment(fset *token.FileSet, roots []*domain.Node, tokenCount int) *Fragment {
+	start := fset.Position(token.Pos(roots[0].GetPosition().GetStart()))
+	end := fset.Position(token.Pos(roots[len(roots)-1].GetPosition().GetEnd()))
+
+	nodes := make([]ast.Node, 0, len(roots))
+	for _, root := range roots {
+		nodes = append(nodes, root.GetNode())
+	}
+
+	return &Fragment{
+		Filename:    start.Filename,
+		StartLine:   start.Line,
+		StartColumn: start.Column,
+		EndLine:     end.Line,
+		EndColumn:   end.Column,
+		TokenCount:  tokenCount,
+		Nodes:       nodes,
+	}
+}
+
+func (f *Fragment) String() string {
+	return fmt.Sprintf("%s:%d:%d-%d:%d", f.Filename, f.StartLine, f.StartColumn, f.EndLine, f.EndColumn)
+}
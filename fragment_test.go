@@ -0,0 +1,117 @@
+package clone
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/serializer"
+)
+
+const fragmentSource = `package p
+
+func sumIf(ok bool, values []int) int {
+	if ok {
+		total := 0
+		for _, value := range values {
+			if value > 0 {
+				total += value
+			}
+		}
+		return total
+	}
+	return 0
+}
+`
+
+func TestNewFragment(t *testing.T) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "a.go", fragmentSource, 0)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	nodeChan := make(chan *domain.Node)
+	go func() {
+		defer close(nodeChan)
+		_ = (&serializer.Serializer{}).Serialize(context.Background(), file, nodeChan)
+	}()
+
+	nodes := map[ast.Node]*domain.Node{}
+	for node := range nodeChan {
+		nodes[node.GetNode()] = node
+	}
+
+	var funcDecl *ast.FuncDecl
+	var ifStmt *ast.IfStmt
+	var rangeStmt *ast.RangeStmt
+	var assignStmt *ast.AssignStmt
+	ast.Inspect(file, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.FuncDecl:
+			funcDecl = n
+		case *ast.IfStmt:
+			if ifStmt == nil {
+				ifStmt = n
+			}
+		case *ast.RangeStmt:
+			rangeStmt = n
+		case *ast.AssignStmt:
+			if n.Tok == token.ADD_ASSIGN {
+				assignStmt = n
+			}
+		}
+
+		return true
+	})
+
+	// 列はタブを1文字として数え、終了位置はコード片の直後を指す
+	tests := []struct {
+		description string
+		node        ast.Node
+		expected    string
+	}{
+		{
+			description: "function declaration",
+			node:        funcDecl,
+			expected:    "a.go:3:1-14:2",
+		},
+		{
+			description: "if statement",
+			node:        ifStmt,
+			expected:    "a.go:4:2-12:3",
+		},
+		{
+			description: "nested range statement",
+			node:        rangeStmt,
+			expected:    "a.go:6:3-10:4",
+		},
+		{
+			description: "single line statement",
+			node:        assignStmt,
+			expected:    "a.go:8:5-8:19",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			node, ok := nodes[test.node]
+			if !ok {
+				t.Fatal("node is not serialized")
+			}
+
+			fragment := newFragment(fset, node)
+			if fragment.String() != test.expected {
+				t.Errorf("unexpected position: expected %s, actual %s", test.expected, fragment)
+			}
+
+			if fragment.TokenCount != int(node.GetChildCount())+1 {
+				t.Errorf("unexpected token count: expected %d, actual %d", node.GetChildCount()+1, fragment.TokenCount)
+			}
+		})
+	}
+}
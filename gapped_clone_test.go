@@ -0,0 +1,117 @@
+package clone_test
+
+import (
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+const halvesSource = `package p
+
+func A(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	count := 0
+	for _, value := range values {
+		if value < 0 {
+			count -= value
+		}
+	}
+	return total + count
+}
+`
+
+const insertedSource = `package p
+
+func B(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	println("inserted", total)
+	count := 0
+	for _, value := range values {
+		if value < 0 {
+			count -= value
+		}
+	}
+	return total + count
+}
+`
+
+func TestGetClonesGapped(t *testing.T) {
+	tests := []struct {
+		description string
+		maxGap      int
+		gapped      bool
+	}{
+		{
+			description: "no gap allowed",
+			maxGap:      0,
+			gapped:      false,
+		},
+		{
+			description: "gap longer than MaxGap",
+			maxGap:      2,
+			gapped:      false,
+		},
+		{
+			description: "gap within MaxGap",
+			maxGap:      10,
+			gapped:      true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, MaxGap: test.maxGap},
+				source{"a.go", halvesSource},
+				source{"b.go", insertedSource},
+			)
+			clonePairs := getClones(t, cd)
+
+			// 挿入した文の前後の半分は、それぞれ完全一致のクローンになる
+			if findClone(clonePairs, "a.go", 5, "b.go", 5) == nil || findClone(clonePairs, "a.go", 11, "b.go", 12) == nil {
+				t.Fatalf("exact halves not found in %d clones", len(clonePairs))
+			}
+
+			var gapped []*clone.ClonePair
+			for _, clonePair := range clonePairs {
+				if clonePair.Type == clone.CloneType3 {
+					gapped = append(gapped, clonePair)
+				}
+			}
+
+			if !test.gapped {
+				if len(gapped) != 0 {
+					t.Errorf("unexpected gapped clone: %s %s", gapped[0].Fragment1, gapped[0].Fragment2)
+				}
+				return
+			}
+
+			if len(gapped) != 1 {
+				t.Fatalf("expected 1 gapped clone, found %d", len(gapped))
+			}
+
+			// 1つのType-3のクローンが、挿入した文を挟んだ両方の半分を含む
+			clonePair := gapped[0]
+			if clonePair.Fragment1.Filename != "a.go" || clonePair.Fragment1.StartLine > 5 || clonePair.Fragment1.EndLine < 15 ||
+				clonePair.Fragment2.Filename != "b.go" || clonePair.Fragment2.StartLine > 5 || clonePair.Fragment2.EndLine < 16 {
+				t.Errorf("gapped clone does not span both halves: %s %s", clonePair.Fragment1, clonePair.Fragment2)
+			}
+			if clonePair.Similarity >= 1 || clonePair.Similarity <= 0.9 {
+				t.Errorf("unexpected similarity: %f", clonePair.Similarity)
+			}
+			if clonePair.Fragment2.TokenCount <= clonePair.Fragment1.TokenCount {
+				t.Errorf("inserted statement is not counted: %d, %d", clonePair.Fragment1.TokenCount, clonePair.Fragment2.TokenCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,132 @@
+package clone
+
+import (
+	"testing"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+)
+
+// newTestSequence documentのindex番目から始まるlength個のノードからなる一致部分
+func newTestSequence(document, index, length int) *domain.CloneSequence {
+	nodes := make([]*domain.Node, 0, length)
+	for i := 0; i < length; i++ {
+		nodes = append(nodes, domain.NewNode(nil, values.NodeTypeIdent, values.NewPosition(0, 0), 0, values.NodeTokenNone, values.NodeValueNone))
+	}
+
+	return domain.NewCloneSequence(document, index, nodes)
+}
+
+type testSegment struct {
+	document1, index1 int
+	document2, index2 int
+	length            int
+}
+
+func newTestSequencePairs(segments ...testSegment) []*domain.CloneSequencePair {
+	pairs := make([]*domain.CloneSequencePair, 0, len(segments))
+	for _, s := range segments {
+		pairs = append(pairs, domain.NewCloneSequencePair(
+			newTestSequence(s.document1, s.index1, s.length),
+			newTestSequence(s.document2, s.index2, s.length),
+		))
+	}
+
+	return pairs
+}
+
+func TestMergeGappedClones(t *testing.T) {
+	const maxGap = 3
+
+	cases := []struct {
+		name     string
+		segments []testSegment
+		// 結合されたクローンごとの一致部分の数
+		expected []int
+	}{
+		{
+			name: "gap equal to max gap",
+			segments: []testSegment{
+				{0, 0, 1, 0, 5},
+				{0, 5 + maxGap, 1, 5 + maxGap, 5},
+			},
+			expected: []int{2},
+		},
+		{
+			name: "gap over max gap",
+			segments: []testSegment{
+				{0, 0, 1, 0, 5},
+				{0, 5 + maxGap + 1, 1, 5 + maxGap + 1, 5},
+			},
+			expected: []int{},
+		},
+		{
+			name: "gap over max gap in second fragment only",
+			segments: []testSegment{
+				{0, 0, 1, 0, 5},
+				{0, 5 + maxGap, 1, 5 + maxGap + 1, 5},
+			},
+			expected: []int{},
+		},
+		{
+			name: "no gap",
+			segments: []testSegment{
+				{0, 0, 1, 0, 5},
+				{0, 5, 1, 5, 5},
+			},
+			expected: []int{2},
+		},
+		{
+			name: "gap across documents",
+			segments: []testSegment{
+				{0, 0, 1, 0, 5},
+				{0, 5 + maxGap, 2, 5 + maxGap, 5},
+			},
+			expected: []int{},
+		},
+		{
+			name: "chain of gaps",
+			segments: []testSegment{
+				{0, 0, 1, 0, 5},
+				{0, 5 + maxGap, 1, 5 + maxGap, 5},
+				{0, 10 + 2*maxGap, 1, 10 + 2*maxGap, 5},
+				{0, 15 + 3*maxGap + 1, 1, 15 + 3*maxGap + 1, 5},
+			},
+			expected: []int{3},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			gappedClones := mergeGappedClones(newTestSequencePairs(c.segments...), maxGap)
+			if len(gappedClones) != len(c.expected) {
+				t.Fatalf("unexpected number of gapped clones: expected %d, actual %d", len(c.expected), len(gappedClones))
+			}
+
+			for i, gc := range gappedClones {
+				if len(gc.segments1) != c.expected[i] || len(gc.segments2) != c.expected[i] {
+					t.Errorf("unexpected number of segments of gapped clone %d: expected %d, actual %d, %d", i, c.expected[i], len(gc.segments1), len(gc.segments2))
+				}
+			}
+		})
+	}
+}
+
+func TestMergeGappedClonesSpan(t *testing.T) {
+	gappedClones := mergeGappedClones(newTestSequencePairs(
+		testSegment{0, 10, 1, 20, 5},
+		testSegment{0, 17, 1, 26, 4},
+	), 2)
+	if len(gappedClones) != 1 {
+		t.Fatalf("unexpected number of gapped clones: expected 1, actual %d", len(gappedClones))
+	}
+
+	span1, span2 := gappedClones[0].span()
+	if span1 != 11 || span2 != 10 {
+		t.Errorf("unexpected span: expected 11, 10, actual %d, %d", span1, span2)
+	}
+	if matched := gappedClones[0].matchedLength(); matched != 9 {
+		t.Errorf("unexpected matched length: expected 9, actual %d", matched)
+	}
+}
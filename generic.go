@@ -0,0 +1,576 @@
+package clone
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"strings"
+)
+
+var ErrNotGeneric = errors.New("clones do not differ only by types")
+
+// TypeParam 型の異なるクローンをまとめた関数の型パラメータ
+type TypeParam struct {
+	Name       string
+	Constraint string
+	// 各コード片での型
+	Args []string
+}
+
+// GenericSuggestion 型だけが異なるクローンクラスを1つのジェネリックな関数にまとめる提案
+type GenericSuggestion struct {
+	CloneClass *CloneClass
+	// 抽出した関数の名前
+	Name       string
+	TypeParams []*TypeParam
+	// 型を推測できずanyにした引数・戻り値
+	UnknownTypes []string
+	// 抽出した関数のソースコード(go/formatで整形したもの、型を推測できなかった場合はその旨のコメントが前に付く)
+	Function string
+	// 各コード片を置き換えるコード(CloneClass.Fragmentsと同じ順)
+	Replacements []string
+}
+
+func (gs *GenericSuggestion) String() string {
+	var sb strings.Builder
+	fragments := make([]string, 0, len(gs.CloneClass.Fragments))
+	for _, fragment := range gs.CloneClass.Fragments {
+		fragments = append(fragments, fragment.String())
+	}
+	fmt.Fprintf(&sb, "%s differ only by types and can be extracted into:\n", strings.Join(fragments, ", "))
+	sb.WriteString(indent(gs.Function))
+	for i, fragment := range gs.CloneClass.Fragments {
+		fmt.Fprintf(&sb, "replace %s with:\n", fragment)
+		sb.WriteString(indent(gs.Replacements[i]))
+	}
+
+	return sb.String()
+}
+
+/*
+SuggestGenericExtraction 型の書かれた部分だけが異なるクローンクラスを、型パラメータを持つ1つの関数にまとめる提案を作る
+型パラメータの制約は、その型の値に使う演算から決める(算術・比較演算には各コード片の型の和、==と!=だけならcomparable)
+型以外(リテラルやパッケージレベルの識別子)も異なる場合や、型の違いがない場合はErrNotGenericを返す
+*/
+func (cd *CloneDetector) SuggestGenericExtraction(cloneClass *CloneClass) (*GenericSuggestion, error) {
+	if len(cloneClass.Nodes) < 2 {
+		return nil, fmt.Errorf("%w: clone class has less than 2 fragments", ErrNotExtractable)
+	}
+	for _, node := range cloneClass.Nodes {
+		if node == nil {
+			return nil, fmt.Errorf("%w: clone does not consist of a single subtree", ErrNotExtractable)
+		}
+	}
+
+	e, err := cd.newExtraction(cloneClass.Nodes, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(e.typeParams) == 0 {
+		return nil, ErrNotGeneric
+	}
+	for _, param := range e.paramList {
+		// 関数の外のものやリテラルが異なる場合は、型以外も異なる
+		if param.objects[0] == nil {
+			return nil, fmt.Errorf("%w: literals differ", ErrNotGeneric)
+		}
+		for i, object := range param.objects {
+			if !e.containsFunc(i, declPos(object)) {
+				return nil, fmt.Errorf("%w: %s differs", ErrNotGeneric, object.Name)
+			}
+		}
+	}
+
+	suggestion := &GenericSuggestion{
+		CloneClass:   cloneClass,
+		Name:         e.name,
+		UnknownTypes: e.unknownTypes,
+		Function:     e.unknownTypesComment() + formatNode(e.function),
+	}
+	for _, tp := range e.typeParams {
+		typeParam := &TypeParam{
+			Name:       tp.name,
+			Constraint: formatNode(tp.constraint),
+		}
+		for _, arg := range tp.args {
+			typeParam.Args = append(typeParam.Args, formatNode(arg))
+		}
+		suggestion.TypeParams = append(suggestion.TypeParams, typeParam)
+	}
+	for _, replacement := range e.replacements {
+		suggestion.Replacements = append(suggestion.Replacements, formatNode(replacement))
+	}
+
+	return suggestion, nil
+}
+
+type typeParam struct {
+	name string
+	// 各コード片での型
+	args       []ast.Expr
+	constraint ast.Expr
+}
+
+// typePositions root内で型が書かれる位置にあるノード
+func typePositions(root ast.Node) map[ast.Node]struct{} {
+	positions := map[ast.Node]struct{}{}
+	mark := func(node ast.Node) {
+		if node != nil && !reflect.ValueOf(node).IsNil() {
+			positions[node] = struct{}{}
+		}
+	}
+
+	ast.Inspect(root, func(node ast.Node) bool {
+		_, isType := positions[node]
+		switch node := node.(type) {
+		case *ast.Field:
+			mark(node.Type)
+		case *ast.ValueSpec:
+			mark(node.Type)
+		case *ast.TypeSpec:
+			mark(node.Type)
+		case *ast.CompositeLit:
+			mark(node.Type)
+		case *ast.TypeAssertExpr:
+			mark(node.Type)
+		case *ast.ArrayType:
+			mark(node.Elt)
+		case *ast.MapType:
+			mark(node.Key)
+			mark(node.Value)
+		case *ast.ChanType:
+			mark(node.Value)
+		case *ast.Ellipsis:
+			mark(node.Elt)
+		case *ast.StarExpr:
+			if isType {
+				mark(node.X)
+			}
+		case *ast.ParenExpr:
+			if isType {
+				mark(node.X)
+			}
+		case *ast.CallExpr:
+			// make・newの引数と、型変換の型
+			if ident, ok := node.Fun.(*ast.Ident); ok && ident.Obj == nil && (ident.Name == "make" || ident.Name == "new") && len(node.Args) > 0 {
+				mark(node.Args[0])
+			}
+			if isTypeName(node.Fun) {
+				mark(node.Fun)
+			}
+		}
+
+		return true
+	})
+
+	return positions
+}
+
+// predeclaredTypes 事前宣言された型の名前
+var predeclaredTypes = map[string]struct{}{
+	"any": {}, "bool": {}, "byte": {}, "comparable": {}, "complex64": {}, "complex128": {}, "error": {},
+	"float32": {}, "float64": {}, "int": {}, "int8": {}, "int16": {}, "int32": {}, "int64": {}, "rune": {},
+	"string": {}, "uint": {}, "uint8": {}, "uint16": {}, "uint32": {}, "uint64": {}, "uintptr": {},
+}
+
+// isTypeName exprが型の名前か(他のファイルやパッケージ外で宣言された型は分からないのでfalse)
+func isTypeName(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	if !ok {
+		return false
+	}
+
+	if ident.Obj == nil {
+		_, ok := predeclaredTypes[ident.Name]
+		return ok
+	}
+
+	return ident.Obj.Kind == ast.Typ
+}
+
+/*
+alignType 各コード片のj番目のノードが型の書かれる位置にあり、型が異なる場合は型パラメータに置き換える
+置き換えた場合はtrueを返す
+*/
+func (e *extraction) alignType(flatNodes [][]ast.Node, j int, skip map[ast.Node]struct{}) (bool, error) {
+	exprs := make([]ast.Expr, 0, len(flatNodes))
+	for i := range flatNodes {
+		switch node := flatNodes[i][j].(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+			if _, ok := e.typePositions[i][node]; !ok {
+				return false, nil
+			}
+			exprs = append(exprs, node.(ast.Expr))
+		default:
+			return false, nil
+		}
+	}
+
+	if !differentTypes(exprs) {
+		return false, nil
+	}
+
+	if selector, ok := exprs[0].(*ast.SelectorExpr); ok {
+		skip[selector.X] = struct{}{}
+		skip[selector.Sel] = struct{}{}
+	}
+
+	e.replace[exprs[0]] = ast.NewIdent(e.typeParam(exprs).name)
+
+	return true, nil
+}
+
+func differentTypes(types []ast.Expr) bool {
+	src := formatNode(types[0])
+	for _, typ := range types[1:] {
+		if formatNode(typ) != src {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeParam 各コード片でtypesになる型パラメータ(同じ組み合わせには同じ型パラメータを使う)
+func (e *extraction) typeParam(types []ast.Expr) *typeParam {
+	srcs := make([]string, 0, len(types))
+	for _, typ := range types {
+		srcs = append(srcs, formatNode(typ))
+	}
+	key := strings.Join(srcs, "\x00")
+
+	if tp, ok := e.typeParamKeys[key]; ok {
+		return tp
+	}
+
+	tp := &typeParam{
+		name: e.uniqueName("T"),
+		args: types,
+	}
+	e.usedNames[tp.name] = struct{}{}
+	e.typeParamKeys[key] = tp
+	e.typeParams = append(e.typeParams, tp)
+
+	return tp
+}
+
+/*
+generalizeType 各コード片で異なる型typesを、異なる部分を型パラメータにした1つの型にする
+型の構造が異なる場合や、型の分からないコード片がある場合はErrNotExtractableを返す
+*/
+func (e *extraction) generalizeType(name string, types []ast.Expr) (ast.Expr, error) {
+	flatTypes := make([][]ast.Node, len(types))
+	for i, typ := range types {
+		if typ == nil {
+			return nil, fmt.Errorf("%w: type of %s is unknown", ErrNotExtractable, name)
+		}
+
+		flatTypes[i], _ = flattenNodes([]ast.Node{typ})
+		if len(flatTypes[i]) != len(flatTypes[0]) {
+			return nil, fmt.Errorf("%w: types of %s differ in structure", ErrNotExtractable, name)
+		}
+	}
+
+	replace := make(map[ast.Node]ast.Node, len(e.replace))
+	for node, replaced := range e.replace {
+		replace[node] = replaced
+	}
+
+	skip := map[ast.Node]struct{}{}
+	for j, node := range flatTypes[0] {
+		if _, ok := skip[node]; ok {
+			continue
+		}
+
+		exprs := make([]ast.Expr, 0, len(flatTypes))
+		for i := range flatTypes {
+			if reflect.TypeOf(flatTypes[i][j]) != reflect.TypeOf(node) {
+				return nil, fmt.Errorf("%w: types of %s differ in structure", ErrNotExtractable, name)
+			}
+			if expr, ok := flatTypes[i][j].(ast.Expr); ok {
+				exprs = append(exprs, expr)
+			}
+		}
+
+		switch node := node.(type) {
+		case *ast.Ident, *ast.SelectorExpr:
+			if !differentTypes(exprs) {
+				continue
+			}
+
+			if selector, ok := node.(*ast.SelectorExpr); ok {
+				skip[selector.X] = struct{}{}
+				skip[selector.Sel] = struct{}{}
+			}
+			replace[node] = ast.NewIdent(e.typeParam(exprs).name)
+		default:
+			for i := range flatTypes[1:] {
+				if !equalNodeAttributes(node, flatTypes[i+1][j]) {
+					return nil, fmt.Errorf("%w: types of %s differ in structure", ErrNotExtractable, name)
+				}
+			}
+		}
+	}
+
+	return copyAST(types[0], replace).(ast.Expr), nil
+}
+
+// addTypeParams 型パラメータの制約を決めて関数に加え、引数から推論できない場合は呼び出しで型を明示する
+func (e *extraction) addTypeParams() error {
+	fields := &ast.FieldList{}
+	for _, tp := range e.typeParams {
+		constraint, err := e.constraint(tp)
+		if err != nil {
+			return err
+		}
+		tp.constraint = constraint
+
+		fields.List = append(fields.List, &ast.Field{
+			Names: []*ast.Ident{ast.NewIdent(tp.name)},
+			Type:  constraint,
+		})
+	}
+	e.function.Type.TypeParams = fields
+
+	// 引数の型に現れない型パラメータは推論できない
+	inferable := true
+	for _, tp := range e.typeParams {
+		inferable = inferable && containsIdent(e.function.Type.Params, tp.name)
+	}
+	if inferable {
+		return nil
+	}
+
+	for i, replacement := range e.replacements {
+		typeArgs := make([]ast.Expr, 0, len(e.typeParams))
+		for _, tp := range e.typeParams {
+			typeArgs = append(typeArgs, copyAST(tp.args[i], nil).(ast.Expr))
+		}
+
+		ast.Inspect(replacement, func(node ast.Node) bool {
+			call, ok := node.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+
+			if ident, ok := call.Fun.(*ast.Ident); ok && ident.Name == e.name {
+				if len(typeArgs) == 1 {
+					call.Fun = &ast.IndexExpr{X: ident, Index: typeArgs[0]}
+				} else {
+					call.Fun = &ast.IndexListExpr{X: ident, Indices: typeArgs}
+				}
+			}
+
+			return true
+		})
+	}
+
+	return nil
+}
+
+func containsIdent(root ast.Node, name string) bool {
+	var found bool
+	ast.Inspect(root, func(node ast.Node) bool {
+		if ident, ok := node.(*ast.Ident); ok && ident.Name == name {
+			found = true
+		}
+
+		return !found
+	})
+
+	return found
+}
+
+/*
+constraint 型パラメータの値に使う演算から制約を決める
+算術・大小比較・型変換を使う場合は各コード片の型の和、==・!=やマップのキーだけならcomparable、何も使わなければany
+フィールドやメソッドは型パラメータから使えないのでErrNotExtractableを返す
+*/
+func (e *extraction) constraint(tp *typeParam) (ast.Expr, error) {
+	isTP := func(typ ast.Expr) bool {
+		ident, ok := typ.(*ast.Ident)
+		return ok && ident.Name == tp.name
+	}
+	hasTP := func(expr ast.Expr) bool {
+		return isTP(e.typeOf(expr, 0))
+	}
+
+	var comparable, union bool
+	var err error
+	ast.Inspect(e.nodes[0], func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.BinaryExpr:
+			if hasTP(node.X) || hasTP(node.Y) {
+				if node.Op == token.EQL || node.Op == token.NEQ {
+					comparable = true
+				} else {
+					union = true
+				}
+			}
+		case *ast.AssignStmt:
+			if node.Tok != token.ASSIGN && node.Tok != token.DEFINE && hasTP(node.Lhs[0]) {
+				union = true
+			}
+		case *ast.IncDecStmt:
+			union = union || hasTP(node.X)
+		case *ast.UnaryExpr:
+			if node.Op == token.SUB || node.Op == token.ADD || node.Op == token.XOR {
+				union = union || hasTP(node.X)
+			}
+		case *ast.CallExpr:
+			// 型パラメータへの型変換と、型パラメータの値の型変換
+			if replaced, ok := e.replace[node.Fun]; ok && isTP(replaced.(ast.Expr)) {
+				union = true
+			}
+			if isTypeName(node.Fun) && len(node.Args) == 1 && hasTP(node.Args[0]) {
+				union = true
+			}
+		case *ast.MapType:
+			comparable = comparable || isTP(copyAST(node.Key, e.replace).(ast.Expr))
+		case *ast.SelectorExpr:
+			typ := e.typeOf(node.X, 0)
+			if star, ok := typ.(*ast.StarExpr); ok {
+				typ = star.X
+			}
+			if isTP(typ) {
+				err = fmt.Errorf("%w: fields and methods of %s cannot be used in a generic function", ErrNotExtractable, node.X)
+			}
+		}
+
+		return err == nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// コード片の外で宣言された引数の型も、マップのキーになっていないか調べる
+	ast.Inspect(e.function.Type.Params, func(node ast.Node) bool {
+		if mapType, ok := node.(*ast.MapType); ok {
+			comparable = comparable || isTP(mapType.Key)
+		}
+
+		return true
+	})
+
+	switch {
+	case union:
+		return typeUnion(tp.args), nil
+	case comparable:
+		return ast.NewIdent("comparable"), nil
+	}
+
+	return ast.NewIdent("any"), nil
+}
+
+// typeUnion typesのいずれかである型の制約(事前宣言された型はその型を基底に持つ型も含める)
+func typeUnion(types []ast.Expr) ast.Expr {
+	var union ast.Expr
+	added := map[string]struct{}{}
+	for _, typ := range types {
+		src := formatNode(typ)
+		if _, ok := added[src]; ok {
+			continue
+		}
+		added[src] = struct{}{}
+
+		term := copyAST(typ, nil).(ast.Expr)
+		if _, ok := predeclaredTypes[src]; ok {
+			term = &ast.UnaryExpr{Op: token.TILDE, X: term}
+		}
+
+		if union == nil {
+			union = term
+		} else {
+			union = &ast.BinaryExpr{X: union, Op: token.OR, Y: term}
+		}
+	}
+
+	return union
+}
+
+/*
+typeOf 先頭のコード片の式exprの、抽出した関数内での型を推測する(分からない場合はnil)
+異なる型は型パラメータに置き換えたものを返す
+*/
+func (e *extraction) typeOf(expr ast.Expr, depth int) ast.Expr {
+	if depth > maxInferDepth {
+		return nil
+	}
+
+	switch expr := expr.(type) {
+	case *ast.ParenExpr:
+		return e.typeOf(expr.X, depth+1)
+	case *ast.Ident:
+		if expr.Obj == nil || expr.Obj.Kind != ast.Var {
+			return nil
+		}
+
+		for _, param := range e.paramList {
+			if param.objects[0] == expr.Obj {
+				return copyAST(param.typ, e.replace).(ast.Expr)
+			}
+		}
+
+		// rangeで宣言された変数は、範囲の式の型から求める
+		if decl, ok := expr.Obj.Decl.(*ast.AssignStmt); ok && len(decl.Rhs) == 1 {
+			if unary, ok := decl.Rhs[0].(*ast.UnaryExpr); ok && unary.Op == token.RANGE {
+				value, ok := decl.Lhs[len(decl.Lhs)-1].(*ast.Ident)
+				isValue := len(decl.Lhs) == 2 && ok && value.Name == expr.Name
+				switch typ := e.typeOf(unary.X, depth+1).(type) {
+				case *ast.ArrayType:
+					if isValue {
+						return typ.Elt
+					}
+				case *ast.MapType:
+					if isValue {
+						return typ.Value
+					}
+					return typ.Key
+				}
+
+				return nil
+			}
+		}
+
+		typ := objectType(expr.Obj, 0)
+		if typ == nil {
+			return nil
+		}
+
+		return copyAST(typ, e.replace).(ast.Expr)
+	case *ast.IndexExpr:
+		switch typ := e.typeOf(expr.X, depth+1).(type) {
+		case *ast.ArrayType:
+			return typ.Elt
+		case *ast.MapType:
+			return typ.Value
+		}
+	case *ast.StarExpr:
+		if typ, ok := e.typeOf(expr.X, depth+1).(*ast.StarExpr); ok {
+			return typ.X
+		}
+	case *ast.CallExpr:
+		if replaced, ok := e.replace[expr.Fun]; ok {
+			return copyAST(replaced, nil).(ast.Expr)
+		}
+	case *ast.CompositeLit:
+		if expr.Type != nil {
+			return copyAST(expr.Type, e.replace).(ast.Expr)
+		}
+	case *ast.BinaryExpr:
+		switch expr.Op {
+		case token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ, token.LAND, token.LOR:
+			return nil
+		}
+
+		if typ := e.typeOf(expr.X, depth+1); typ != nil {
+			return typ
+		}
+		return e.typeOf(expr.Y, depth+1)
+	}
+
+	return nil
+}
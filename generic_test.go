@@ -0,0 +1,90 @@
+package clone_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// suggestGenericExtraction a.goとb.goのクローンクラスを1つのジェネリックな関数にまとめる提案を作る
+func suggestGenericExtraction(t *testing.T, src1, src2 string) (*clone.GenericSuggestion, error) {
+	t.Helper()
+
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", src1},
+		source{"b.go", src2},
+	)
+
+	cloneClasses, err := cd.GetCloneClasses()
+	if err != nil {
+		t.Fatalf("failed to get clone classes: %v", err)
+	}
+	if len(cloneClasses) != 1 {
+		t.Fatalf("unexpected clone classes: %v", cloneClassStrings(cloneClasses))
+	}
+
+	return cd.SuggestGenericExtraction(cloneClasses[0])
+}
+
+func TestSuggestGenericExtraction(t *testing.T) {
+	suggestion, err := suggestGenericExtraction(t, `package p
+
+func SumInts(values []int) int {
+	var total int
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+`, `package p
+
+func SumFloats(values []float64) float64 {
+	var total float64
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+const limit = 3
+`)
+	if err != nil {
+		t.Fatalf("failed to suggest generic extraction: %v", err)
+	}
+
+	if len(suggestion.TypeParams) != 1 {
+		t.Fatalf("unexpected number of type parameters: %d", len(suggestion.TypeParams))
+	}
+	typeParam := suggestion.TypeParams[0]
+	if typeParam.Constraint != "~int | ~float64" || strings.Join(typeParam.Args, " ") != "int float64" {
+		t.Errorf("unexpected type parameter: %s %s %v", typeParam.Name, typeParam.Constraint, typeParam.Args)
+	}
+
+	expected := `func extracted[T ~int | ~float64](values []T) T {
+	var total T
+	for _, value := range values {
+		total += value
+	}
+	return total
+}`
+	if suggestion.Function != expected {
+		t.Errorf("unexpected function:\nexpected\n%s\nactual\n%s", expected, suggestion.Function)
+	}
+	for i, name := range []string{"SumInts", "SumFloats"} {
+		if !strings.Contains(suggestion.Replacements[i], name+"(") || !strings.Contains(suggestion.Replacements[i], "return extracted(values)") {
+			t.Errorf("unexpected replacement of %s:\n%s", name, suggestion.Replacements[i])
+		}
+	}
+}
+
+func TestSuggestGenericExtractionNotGeneric(t *testing.T) {
+	// 名前だけが異なり、型は同じ
+	_, err := suggestGenericExtraction(t, sumSource, countSource+`
+const limit = 3
+`)
+	if !errors.Is(err, clone.ErrNotGeneric) {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
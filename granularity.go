@@ -0,0 +1,301 @@
+package clone
+
+import (
+	"context"
+	"go/ast"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+)
+
+// Granularity クローンとして報告するコード片の構文上の単位
+type Granularity int
+
+const (
+	// GranularityAny 閾値より大きい任意の部分木(デフォルト)
+	GranularityAny Granularity = iota
+	// GranularityFunction 関数宣言・関数リテラル全体か、その本体
+	GranularityFunction
+	// GranularityBlock ブロック文
+	GranularityBlock
+	/*
+		GranularityStatementSequence 文(case節・select節は除く)
+		ブロック文・case節・select節の本体に連続して並ぶ文は、1つのクローン・クローンクラスにまとめる
+		文の並びを求めるためにファイル全体のASTが必要なので、*ast.File以外を追加するとErrFileRequiredを返す
+	*/
+	GranularityStatementSequence
+	// GranularityExpression 式(型を表す式は除く)
+	GranularityExpression
+)
+
+func (g Granularity) String() string {
+	switch g {
+	case GranularityAny:
+		return "any"
+	case GranularityFunction:
+		return "function"
+	case GranularityBlock:
+		return "block"
+	case GranularityStatementSequence:
+		return "statement-sequence"
+	case GranularityExpression:
+		return "expression"
+	}
+
+	return "unknown"
+}
+
+var (
+	statementNodeTypes = map[values.NodeType]struct{}{
+		values.NodeTypeAssignStmt:     {},
+		values.NodeTypeBlockStmt:      {},
+		values.NodeTypeBranchStmt:     {},
+		values.NodeTypeDeclStmt:       {},
+		values.NodeTypeDeferStmt:      {},
+		values.NodeTypeEmptyStmt:      {},
+		values.NodeTypeExprStmt:       {},
+		values.NodeTypeForStmt:        {},
+		values.NodeTypeGoStmt:         {},
+		values.NodeTypeIfStmt:         {},
+		values.NodeTypeIncDecStmt:     {},
+		values.NodeTypeLabeledStmt:    {},
+		values.NodeTypeRangeStmt:      {},
+		values.NodeTypeReturnStmt:     {},
+		values.NodeTypeSelectStmt:     {},
+		values.NodeTypeSendStmt:       {},
+		values.NodeTypeSwitchStmt:     {},
+		values.NodeTypeTypeSwitchStmt: {},
+	}
+	expressionNodeTypes = map[values.NodeType]struct{}{
+		values.NodeTypeBasicLit:       {},
+		values.NodeTypeBinaryExpr:     {},
+		values.NodeTypeCallExpr:       {},
+		values.NodeTypeCompositeLit:   {},
+		values.NodeTypeFuncLit:        {},
+		values.NodeTypeIdent:          {},
+		values.NodeTypeIndexExpr:      {},
+		values.NodeTypeIndexListExpr:  {},
+		values.NodeTypeParenExpr:      {},
+		values.NodeTypeSelectorExpr:   {},
+		values.NodeTypeSliceExpr:      {},
+		values.NodeTypeStarExpr:       {},
+		values.NodeTypeTypeAssertExpr: {},
+		values.NodeTypeUnaryExpr:      {},
+	}
+)
+
+// isUnit nodeが設定した粒度の単位になるノードか
+func (cd *CloneDetector) isUnit(node *domain.Node) bool {
+	nodeType := node.GetNodeType()
+	switch cd.config.Granularity {
+	case GranularityFunction:
+		switch nodeType {
+		case values.NodeTypeFuncDecl, values.NodeTypeFuncLit:
+			return true
+		case values.NodeTypeBlockStmt:
+			return cd.isFuncBody(node.GetNode())
+		}
+		return false
+	case GranularityBlock:
+		return nodeType == values.NodeTypeBlockStmt
+	case GranularityStatementSequence:
+		_, ok := statementNodeTypes[nodeType]
+		return ok
+	case GranularityExpression:
+		_, ok := expressionNodeTypes[nodeType]
+		return ok
+	}
+
+	return true
+}
+
+// areUnits 全てのノード列のi番目のノードが粒度の単位になるか
+func (cd *CloneDetector) areUnits(sequences [][]*domain.Node) func(i int) bool {
+	if cd.config.Granularity == GranularityAny {
+		return nil
+	}
+
+	return func(i int) bool {
+		for _, sequence := range sequences {
+			if !cd.isUnit(sequence[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// isFuncBody nodeが関数宣言か関数リテラルの本体か(ファイル全体を追加していない場合はfalse)
+func (cd *CloneDetector) isFuncBody(node ast.Node) bool {
+	if node == nil {
+		return false
+	}
+
+	funcDecl := cd.enclosingFunc(node)
+	if funcDecl == nil {
+		return false
+	}
+	if funcDecl.Body == node {
+		return true
+	}
+
+	var found bool
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+		if funcLit, ok := n.(*ast.FuncLit); ok && funcLit.Body == node {
+			found = true
+		}
+
+		return !found && n != nil && n.Pos() <= node.Pos() && node.End() <= n.End()
+	})
+
+	return found
+}
+
+/*
+gappedUnits ギャップのあるクローンが、両方のコード片でギャップを含む粒度の単位の部分木を覆っている場合はその根を返す
+単位になる部分木がない場合はnilを返す
+*/
+func (cd *CloneDetector) gappedUnits(ctx context.Context, gc *gappedClone) (*domain.Node, *domain.Node, error) {
+	root1, err := cd.gappedUnit(ctx, gc.segments1)
+	if err != nil || root1 == nil {
+		return nil, nil, err
+	}
+
+	root2, err := cd.gappedUnit(ctx, gc.segments2)
+	if err != nil || root2 == nil {
+		return nil, nil, err
+	}
+
+	return root1, root2, nil
+}
+
+/*
+gappedUnit 一致部分の並びに覆われる、ギャップを含む粒度の単位の部分木のうち最も大きいものの根を返す
+ギャップを含む部分木はギャップの分だけ子の数が異なるので、根やその祖先は一致部分に含まれず、末尾の一致部分の後に続く
+そのため、末尾の一致部分の最後のノードの祖先のうち、帰りがけ順で最後の一致部分より前の一致部分から始まり、
+末尾の一致部分の後にはその祖先しか含まないものを根の候補にする
+*/
+func (cd *CloneDetector) gappedUnit(ctx context.Context, segments []*domain.CloneSequence) (*domain.Node, error) {
+	// 一致部分のノードと、それを含む一致部分の位置
+	matched := map[ast.Node]int{}
+	for i, segment := range segments {
+		for _, node := range segment.GetNodes() {
+			if node.GetNode() != nil {
+				matched[node.GetNode()] = i
+			}
+		}
+	}
+
+	lastNodes := segments[len(segments)-1].GetNodes()
+	last := lastNodes[len(lastNodes)-1].GetNode()
+	if last == nil {
+		return nil, nil
+	}
+
+	file, ok := cd.astFiles[cd.fset.File(last.Pos())]
+	if !ok {
+		return nil, nil
+	}
+
+	path := ancestors(file, last)
+	candidates := map[ast.Node]struct{}{}
+	var outermost ast.Node
+	for i := len(path) - 1; i >= 0; i-- {
+		if i < len(path)-1 && lastChild(path[i]) != path[i+1] {
+			// lastの後に祖先でないノードが続く
+			break
+		}
+
+		if segment, ok := matched[firstLeaf(path[i])]; ok && segment < len(segments)-1 {
+			candidates[path[i]] = struct{}{}
+			outermost = path[i]
+		}
+	}
+	if outermost == nil {
+		return nil, nil
+	}
+
+	// 候補は全てoutermostの部分木に含まれ、帰りがけ順では外側のものほど後にある
+	sequence, err := cd.serialize(ctx, outermost)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := len(sequence) - 1; i >= 0; i-- {
+		if _, ok := candidates[sequence[i].GetNode()]; ok && cd.isUnit(sequence[i]) {
+			return sequence[i], nil
+		}
+	}
+
+	return nil, nil
+}
+
+// ancestors rootからnodeまでの経路上のノード(外側から順に、nodeを含む)
+func ancestors(root ast.Node, node ast.Node) []ast.Node {
+	var path []ast.Node
+	stack := []ast.Node{}
+	ast.Inspect(root, func(n ast.Node) bool {
+		if path != nil {
+			return false
+		}
+
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if n.Pos() > node.Pos() || node.End() > n.End() {
+			// nodeを含まない部分木は見ない(子を見ない場合はnilで呼ばれないのでstackに積まない)
+			return false
+		}
+
+		stack = append(stack, n)
+		if n == node {
+			path = append([]ast.Node{}, stack...)
+			return false
+		}
+
+		return true
+	})
+
+	return path
+}
+
+// firstLeaf rootの部分木で帰りがけ順の先頭になるノード
+func firstLeaf(root ast.Node) ast.Node {
+	var leaf, last ast.Node
+	ast.Inspect(root, func(n ast.Node) bool {
+		if leaf != nil {
+			return false
+		}
+
+		if n == nil {
+			// 最初にnilで呼ばれるのは、子を持たないノードを見た直後
+			leaf = last
+			return false
+		}
+		last = n
+
+		return true
+	})
+
+	return leaf
+}
+
+// lastChild nodeの子のうち帰りがけ順で最後のもの
+func lastChild(node ast.Node) ast.Node {
+	var child ast.Node
+	ast.Inspect(node, func(n ast.Node) bool {
+		if n == nil {
+			return false
+		}
+		if n == node {
+			return true
+		}
+
+		child = n
+		return false
+	})
+
+	return child
+}
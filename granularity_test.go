@@ -0,0 +1,131 @@
+package clone_test
+
+import (
+	"fmt"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+const gappedSource1 = `package p
+
+func A(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	println("a")
+	count := len(values)
+	for i := 0; i < count; i++ {
+		total += i * 2
+	}
+	return total
+}
+`
+
+// gappedSource2 gappedSource1と、間の1文の大きさだけが異なる
+const gappedSource2 = `package p
+
+func B(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	println("b", n)
+	count := len(items)
+	for i := 0; i < count; i++ {
+		n += i * 2
+	}
+	return n
+}
+`
+
+func TestGranularityGapped(t *testing.T) {
+	cases := []struct {
+		granularity clone.Granularity
+		// 報告されるコード片の根と、それぞれの開始位置の列
+		root                       string
+		startColumn1, startColumn2 int
+	}{
+		{clone.GranularityFunction, "*ast.FuncDecl", 1, 1},
+		{clone.GranularityBlock, "*ast.BlockStmt", 26, 25},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.granularity.String(), func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, MaxGap: 10, Granularity: c.granularity},
+				source{"a.go", gappedSource1},
+				source{"b.go", gappedSource2},
+			)
+			clonePairs := getClones(t, cd)
+
+			clonePair := findClone(clonePairs, "a.go", 3, "b.go", 3)
+			if clonePair == nil {
+				t.Fatalf("gapped clone not found: %v", clonePairStrings(clonePairs))
+			}
+			if clonePair.Type != clone.CloneType3 {
+				t.Errorf("unexpected clone type: %s", clonePair.Type)
+			}
+			if root1, root2 := fmt.Sprintf("%T", clonePair.Node1), fmt.Sprintf("%T", clonePair.Node2); root1 != c.root || root2 != c.root {
+				t.Errorf("unexpected roots: %s, %s", root1, root2)
+			}
+			// 宣言の途中からではなく、単位の部分木全体を覆う
+			if clonePair.Fragment1.StartColumn != c.startColumn1 || clonePair.Fragment2.StartColumn != c.startColumn2 ||
+				clonePair.Fragment1.EndLine != 16 || clonePair.Fragment2.EndLine != 16 {
+				t.Errorf("fragments do not cover the whole function: %s %s", clonePair.Fragment1, clonePair.Fragment2)
+			}
+		})
+	}
+}
+
+func TestGranularityStatementInCase(t *testing.T) {
+	// 2つ目のcase節だけが一致し、switch文全体は一致しない
+	cd := newSourceDetector(t, clone.Config{Threshold: 10, Granularity: clone.GranularityStatementSequence},
+		source{"a.go", `package p
+
+func A(kind int, values []int) int {
+	total := 0
+	switch kind {
+	case 0:
+		println("zero")
+	case 1:
+		for _, value := range values {
+			total += value
+		}
+		total *= 2
+	}
+	return total
+}
+`},
+		source{"b.go", `package p
+
+func B(kind int, items []int) int {
+	n := 0
+	switch kind {
+	case 0:
+		return -1
+	case 1:
+		for _, item := range items {
+			n += item
+		}
+		n *= 2
+	}
+	return n
+}
+`},
+	)
+	clonePairs := getClones(t, cd)
+
+	clonePair := findClone(clonePairs, "a.go", 9, "b.go", 9)
+	if clonePair == nil {
+		t.Fatalf("clone of statements in case clauses not found: %v", clonePairStrings(clonePairs))
+	}
+	if clonePair.Fragment1.EndLine != 12 || clonePair.Fragment2.EndLine != 12 || len(clonePair.Fragment1.Nodes) != 2 {
+		t.Errorf("clone does not cover the statements of the case clause: %s %s", clonePair.Fragment1, clonePair.Fragment2)
+	}
+}
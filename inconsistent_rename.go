@@ -0,0 +1,221 @@
+package clone
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+)
+
+/*
+InconsistentRename コピー後の名前の置き換えが一部だけ漏れている箇所
+クローンの大半の箇所でName1がName2に置き換えられているのに、Ident1とIdent2の箇所だけ対応が崩れている
+*/
+type InconsistentRename struct {
+	ClonePair *ClonePair
+	// 多数の箇所で対応している1つ目、2つ目のコード片の識別子名(置き換えられていない名前の場合は同じ)
+	Name1 string
+	Name2 string
+	// Name1とName2が対応している箇所の数
+	Count int
+	// 対応が崩れている箇所の識別子
+	Ident1    *ast.Ident
+	Ident2    *ast.Ident
+	Position1 token.Position
+	Position2 token.Position
+}
+
+func (ir *InconsistentRename) String() string {
+	if ir.Ident1.Name == ir.Name1 {
+		// 2つ目のコード片の名前がName2になっていない
+		return fmt.Sprintf(
+			"%s: %s is used where %s is expected (%s corresponds to %s in %d places of the clone at %s)",
+			ir.Position2, ir.Ident2.Name, ir.Name2, ir.Name1, ir.Name2, ir.Count, ir.Position1,
+		)
+	}
+
+	return fmt.Sprintf(
+		"%s: %s is used where %s is expected (%s corresponds to %s in %d places of the clone at %s)",
+		ir.Position1, ir.Ident1.Name, ir.Name1, ir.Name1, ir.Name2, ir.Count, ir.Position2,
+	)
+}
+
+// FindInconsistentRenames クローン間の識別子の対応を調べ、名前の置き換え漏れと思われる箇所を返す
+func (cd *CloneDetector) FindInconsistentRenames() ([]*InconsistentRename, error) {
+	clonePairs, err := cd.getClones(false)
+	if err != nil {
+		return nil, err
+	}
+
+	type identPosition struct {
+		pos1, pos2 token.Pos
+	}
+	reported := map[identPosition]struct{}{}
+
+	inconsistentRenames := []*InconsistentRename{}
+	for _, clonePair := range clonePairs {
+		if clonePair.Type == CloneType1 {
+			continue
+		}
+
+		identPairs, ok := alignIdentifiers(clonePair.Fragment1.Nodes, clonePair.Fragment2.Nodes)
+		if !ok {
+			continue
+		}
+
+		for _, inconsistentRename := range findInconsistentRenames(identPairs) {
+			key := identPosition{inconsistentRename.Ident1.Pos(), inconsistentRename.Ident2.Pos()}
+			if _, ok := reported[key]; ok {
+				continue
+			}
+			reported[key] = struct{}{}
+
+			inconsistentRename.ClonePair = clonePair
+			inconsistentRename.Position1 = cd.fset.Position(inconsistentRename.Ident1.Pos())
+			inconsistentRename.Position2 = cd.fset.Position(inconsistentRename.Ident2.Pos())
+			inconsistentRenames = append(inconsistentRenames, inconsistentRename)
+		}
+	}
+
+	return inconsistentRenames, nil
+}
+
+/*
+findInconsistentRenames 識別子の対応のうち、多数派の置き換えに従わない箇所を返す
+1つ目から2つ目への対応と、2つ目から1つ目への対応の両方向を調べ、同じ箇所が両方向で見つかった場合は
+多数派が置き換えられていない名前(両方のコード片で同じ名前)の方を、どちらもそうでなければ多数派の箇所が多い方を採用する
+(同数の場合は2つ目のコード片の誤りとみなす)
+*/
+func findInconsistentRenames(identPairs []*identifierPair) []*InconsistentRename {
+	inconsistentRenames := []*InconsistentRename{}
+	renameMap := map[*identifierPair]int{}
+	addRename := func(identPair *identifierPair, inconsistentRename *InconsistentRename) {
+		i, ok := renameMap[identPair]
+		if !ok {
+			renameMap[identPair] = len(inconsistentRenames)
+			inconsistentRenames = append(inconsistentRenames, inconsistentRename)
+			return
+		}
+
+		identity, prevIdentity := inconsistentRename.Name1 == inconsistentRename.Name2, inconsistentRenames[i].Name1 == inconsistentRenames[i].Name2
+		if identity != prevIdentity {
+			if identity {
+				inconsistentRenames[i] = inconsistentRename
+			}
+			return
+		}
+
+		if inconsistentRename.Count > inconsistentRenames[i].Count {
+			inconsistentRenames[i] = inconsistentRename
+		}
+	}
+
+	forward := groupIdentifierPairs(identPairs, func(identPair *identifierPair) (string, string) {
+		return identPair.ident1.Name, identPair.ident2.Name
+	})
+	for _, mapping := range forward {
+		for _, identPair := range mapping.minority {
+			addRename(identPair, &InconsistentRename{
+				Name1:  mapping.from,
+				Name2:  mapping.to,
+				Count:  mapping.count,
+				Ident1: identPair.ident1,
+				Ident2: identPair.ident2,
+			})
+		}
+	}
+
+	backward := groupIdentifierPairs(identPairs, func(identPair *identifierPair) (string, string) {
+		return identPair.ident2.Name, identPair.ident1.Name
+	})
+	for _, mapping := range backward {
+		for _, identPair := range mapping.minority {
+			addRename(identPair, &InconsistentRename{
+				Name1:  mapping.to,
+				Name2:  mapping.from,
+				Count:  mapping.count,
+				Ident1: identPair.ident1,
+				Ident2: identPair.ident2,
+			})
+		}
+	}
+
+	return inconsistentRenames
+}
+
+type identifierMapping struct {
+	from, to string
+	// fromがtoに対応している箇所の数
+	count int
+	// fromがto以外に対応している箇所
+	minority []*identifierPair
+}
+
+/*
+groupIdentifierPairs 識別子ごとに多数派の対応先を求める
+多数派が2箇所以上かつ他の対応先の合計より多い場合のみ返す
+置き換えられていない同じ名前への対応も多数派になり得る
+*/
+func groupIdentifierPairs(identPairs []*identifierPair, names func(*identifierPair) (string, string)) []*identifierMapping {
+	fromNames := []string{}
+	targets := map[string]map[string][]*identifierPair{}
+	for _, identPair := range identPairs {
+		from, to := names(identPair)
+		if from == "_" || to == "_" {
+			continue
+		}
+
+		if _, ok := targets[from]; !ok {
+			targets[from] = map[string][]*identifierPair{}
+			fromNames = append(fromNames, from)
+		}
+		targets[from][to] = append(targets[from][to], identPair)
+	}
+
+	mappings := []*identifierMapping{}
+	for _, from := range fromNames {
+		if len(targets[from]) < 2 {
+			continue
+		}
+
+		toNames := make([]string, 0, len(targets[from]))
+		for to := range targets[from] {
+			toNames = append(toNames, to)
+		}
+		sort.Slice(toNames, func(i, j int) bool {
+			if len(targets[from][toNames[i]]) == len(targets[from][toNames[j]]) {
+				return toNames[i] < toNames[j]
+			}
+
+			return len(targets[from][toNames[i]]) > len(targets[from][toNames[j]])
+		})
+
+		majority := toNames[0]
+		count := len(targets[from][majority])
+		if count < 2 || count <= len(identPairsOf(targets[from], toNames[1:])) {
+			continue
+		}
+
+		mappings = append(mappings, &identifierMapping{
+			from:     from,
+			to:       majority,
+			count:    count,
+			minority: identPairsOf(targets[from], toNames[1:]),
+		})
+	}
+
+	return mappings
+}
+
+func identPairsOf(targets map[string][]*identifierPair, names []string) []*identifierPair {
+	identPairs := []*identifierPair{}
+	for _, name := range names {
+		identPairs = append(identPairs, targets[name]...)
+	}
+
+	sort.Slice(identPairs, func(i, j int) bool {
+		return identPairs[i].ident1.Pos() < identPairs[j].ident1.Pos()
+	})
+
+	return identPairs
+}
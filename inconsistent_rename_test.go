@@ -0,0 +1,142 @@
+package clone_test
+
+import (
+	"reflect"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+func findInconsistentRenames(t *testing.T, src1, src2 string) []*clone.InconsistentRename {
+	t.Helper()
+
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"a.go", src1},
+		source{"b.go", src2},
+	)
+
+	inconsistentRenames, err := cd.FindInconsistentRenames()
+	if err != nil {
+		t.Fatalf("failed to find inconsistent renames: %v", err)
+	}
+
+	return inconsistentRenames
+}
+
+func TestFindInconsistentRenames(t *testing.T) {
+	cases := []struct {
+		name       string
+		src1, src2 string
+		expected   []string
+	}{
+		{
+			// 2つ目のコード片でaをcに置き換え忘れている
+			name: "leftover in second fragment",
+			src1: `package p
+
+func A(a, b int) int {
+	x := a + b
+	y := a * b
+	return x + y + a
+}
+`,
+			src2: `package p
+
+func B(c, d int) int {
+	x := c + d
+	y := a * d
+	return x + y + c
+}
+`,
+			expected: []string{
+				"b.go:5:7: a is used where c is expected (a corresponds to c in 3 places of the clone at a.go:5:7)",
+			},
+		},
+		{
+			// 1つ目のコード片のbがaになるべき箇所にある
+			name: "leftover in first fragment",
+			src1: `package p
+
+func A(a, b int) int {
+	x := a + 1
+	y := b * b
+	return x + y + a
+}
+`,
+			src2: `package p
+
+func B(c, d int) int {
+	x := c + 1
+	y := c * d
+	return x + y + c
+}
+`,
+			expected: []string{
+				"a.go:5:7: b is used where a is expected (a corresponds to c in 3 places of the clone at b.go:5:7)",
+			},
+		},
+		{
+			// zは置き換えられていないので、2つ目のコード片のcがzの誤り
+			name: "identity majority",
+			src1: `package p
+
+import "fmt"
+
+func A(a, b int) {
+	x, y, z := a+1, b+2, a*b
+	fmt.Println(x, y, z)
+	fmt.Println(z)
+}
+`,
+			src2: `package p
+
+import "fmt"
+
+func B(c, d int) {
+	x, y, z := c+1, d+2, c*d
+	fmt.Println(x, y, c)
+	fmt.Println(z)
+}
+`,
+			expected: []string{
+				"b.go:7:20: c is used where z is expected (z corresponds to z in 2 places of the clone at a.go:7:20)",
+			},
+		},
+		{
+			name: "consistent rename",
+			src1: `package p
+
+func A(a, b int) int {
+	x := a + b
+	y := a * b
+	return x + y
+}
+`,
+			src2: `package p
+
+func B(c, d int) int {
+	x := c + d
+	y := c * d
+	return x + y
+}
+`,
+			expected: []string{},
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			inconsistentRenames := findInconsistentRenames(t, c.src1, c.src2)
+
+			actual := make([]string, 0, len(inconsistentRenames))
+			for _, inconsistentRename := range inconsistentRenames {
+				actual = append(actual, inconsistentRename.String())
+			}
+
+			if !reflect.DeepEqual(c.expected, actual) {
+				t.Errorf("unexpected inconsistent renames:\nexpected %v\nactual   %v", c.expected, actual)
+			}
+		})
+	}
+}
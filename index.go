@@ -0,0 +1,199 @@
+package clone
+
+import (
+	"bufio"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"go/token"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/mazrean/go-clone-detection/serializer"
+	"github.com/mazrean/go-clone-detection/stree"
+)
+
+// IndexVersion SaveIndexで書き出す形式のバージョン(互換性のない変更をしたときに上げる)
+const IndexVersion = 1
+
+var indexMagic = []byte("GCDINDEX")
+
+var (
+	ErrUnsupportedIndex = errors.New("unsupported index")
+	ErrSaveNotSupported = errors.New("suffix tree does not support saving")
+	ErrIndexMismatch    = errors.New("index does not match the config")
+	ErrASTRequired      = errors.New("config requires ASTs, which are not saved in the index")
+)
+
+// PersistentSuffixTree SaveIndexで書き出せるSuffixTree
+type PersistentSuffixTree interface {
+	SuffixTree
+	Save(w io.Writer) error
+}
+
+type indexHeader struct {
+	Version   int
+	MatchMode serializer.Mode
+	Files     []*indexFile
+}
+
+// indexFile 追加したファイルの位置情報と、そのファイルのASTを追加した接尾辞木の入力
+type indexFile struct {
+	Name      string
+	Documents []int
+	Base      int
+	Size      int
+	// 各行の先頭のオフセット
+	Lines []int
+}
+
+/*
+SaveIndex 追加済みのファイルのノード列、接尾辞木の構造と位置情報を書き出す
+LoadIndexで読み込むと、接尾辞木を作り直さずに復元でき、変更のあったファイルのみReplaceFileで追加し直せる
+*/
+func (cd *CloneDetector) SaveIndex(w io.Writer) error {
+	suffixTree, ok := cd.suffixTree.(PersistentSuffixTree)
+	if !ok {
+		return ErrSaveNotSupported
+	}
+
+	header := &indexHeader{
+		Version:   IndexVersion,
+		MatchMode: cd.config.MatchMode,
+	}
+	// 同じファイル名でも別々にパースしたものは位置が異なるので、token.Fileごとにまとめる
+	fileDocuments := map[*token.File][]int{}
+	for document, tokenFile := range cd.tokenFiles {
+		fileDocuments[tokenFile] = append(fileDocuments[tokenFile], document)
+	}
+	for tokenFile, documents := range fileDocuments {
+		// 追加した順に戻せるようにする
+		sort.Ints(documents)
+
+		lines := make([]int, 0, tokenFile.LineCount())
+		for line := 1; line <= tokenFile.LineCount(); line++ {
+			lines = append(lines, tokenFile.Offset(tokenFile.LineStart(line)))
+		}
+
+		header.Files = append(header.Files, &indexFile{
+			Name:      tokenFile.Name(),
+			Documents: documents,
+			Base:      tokenFile.Base(),
+			Size:      tokenFile.Size(),
+			Lines:     lines,
+		})
+	}
+
+	// LoadIndexでFileSetに追加できる順に並べる
+	sort.Slice(header.Files, func(i, j int) bool {
+		return header.Files[i].Base < header.Files[j].Base
+	})
+
+	bw := bufio.NewWriter(w)
+
+	_, err := bw.Write(indexMagic)
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	err = gob.NewEncoder(bw).Encode(header)
+	if err != nil {
+		return fmt.Errorf("failed to encode index: %w", err)
+	}
+
+	err = suffixTree.Save(bw)
+	if err != nil {
+		return fmt.Errorf("suffix tree error: %w", err)
+	}
+
+	err = bw.Flush()
+	if err != nil {
+		return fmt.Errorf("failed to write index: %w", err)
+	}
+
+	return nil
+}
+
+/*
+LoadIndex SaveIndexで書き出したファイルを追加済みのCloneDetectorを作る
+config.SuffixTreeは読み込んだ接尾辞木で置き換える
+config.FileSetにはファイルを追加する前のものを渡す必要がある
+ASTは書き出されないので、読み込んだファイルのクローンはNode1/Node2がnilになり、種類はCloneTypeUnknownになる
+ASTが必要な設定(ParameterizedMatch、GranularityFunction、GranularityStatementSequence)ではErrASTRequiredを返す
+*/
+func LoadIndex(config *Config, r io.Reader) (*CloneDetector, error) {
+	if config == nil {
+		config = DefaultConfig
+	}
+	copiedConfig := *config
+	config = &copiedConfig
+
+	if config.FileSet == nil {
+		config.FileSet = token.NewFileSet()
+	}
+
+	if config.ParameterizedMatch {
+		return nil, fmt.Errorf("%w: parameterized match", ErrASTRequired)
+	}
+	if config.Granularity == GranularityFunction || config.Granularity == GranularityStatementSequence {
+		return nil, fmt.Errorf("%w: %s granularity", ErrASTRequired, config.Granularity)
+	}
+
+	if config.FileSet.Base() != token.NewFileSet().Base() {
+		return nil, fmt.Errorf("%w: file set is not empty", ErrIndexMismatch)
+	}
+
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(indexMagic))
+	_, err := io.ReadFull(br, magic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read index: %w", err)
+	}
+
+	if string(magic) != string(indexMagic) {
+		return nil, ErrUnsupportedIndex
+	}
+
+	var header indexHeader
+	err = gob.NewDecoder(br).Decode(&header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode index: %w", err)
+	}
+
+	if header.Version != IndexVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedIndex, header.Version)
+	}
+
+	// 識別子名などの比較の有無が異なると、同じコードでも一致しなくなる
+	if config.Serializer == nil && header.MatchMode != config.MatchMode {
+		return nil, fmt.Errorf("%w: match mode", ErrIndexMismatch)
+	}
+
+	suffixTree, err := stree.Load(br)
+	if err != nil {
+		return nil, fmt.Errorf("suffix tree error: %w", err)
+	}
+	config.SuffixTree = suffixTree
+
+	cd := NewCloneDetector(config)
+	for _, file := range header.Files {
+		// 壊れたインデックスでFileSetがpanicしないよう、追加できる位置か先に確かめる
+		if file.Base < cd.fset.Base() || file.Size < 0 || file.Size > math.MaxInt-file.Base {
+			return nil, fmt.Errorf("%w: invalid position of %s", ErrUnsupportedIndex, file.Name)
+		}
+
+		tokenFile := cd.fset.AddFile(file.Name, file.Base, file.Size)
+		if !tokenFile.SetLines(file.Lines) {
+			return nil, fmt.Errorf("%w: invalid lines of %s", ErrUnsupportedIndex, file.Name)
+		}
+
+		cd.files[file.Name] = append(cd.files[file.Name], file.Documents...)
+		for _, document := range file.Documents {
+			cd.tokenFiles[document] = tokenFile
+		}
+	}
+
+	return cd, nil
+}
@@ -0,0 +1,223 @@
+package clone_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"go/parser"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/sarray"
+)
+
+// clonePositionStrings 読み込んだ後は種類が分からないので、位置・ノード数・フィンガープリントだけで比べる
+func clonePositionStrings(clonePairs []*clone.ClonePair) []string {
+	lines := make([]string, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		lines = append(lines, clonePair.Fragment1.String()+" "+clonePair.Fragment2.String()+" "+clonePair.Fingerprint)
+	}
+	sort.Strings(lines)
+
+	return lines
+}
+
+// newIndexDetector 完全に一致するクローン・名前の異なるクローン・一部だけが一致するクローンを含むファイルを追加したCloneDetectorを作る
+func newIndexDetector(t *testing.T) *clone.CloneDetector {
+	t.Helper()
+
+	return newSourceDetector(t, clone.Config{Threshold: 10, MaxGap: 10},
+		source{"a.go", sumSource},
+		source{"b.go", countSource},
+		source{"c.go", joinSource},
+		source{"d.go", sumSource + "\nvar limit = 3\n"},
+		source{"e.go", strings.Replace(sumSource, "\treturn total\n", "\tprintln(total)\n\treturn total\n", 1)},
+	)
+}
+
+func saveIndex(t *testing.T, cd *clone.CloneDetector) []byte {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := cd.SaveIndex(&buf)
+	if err != nil {
+		t.Fatalf("failed to save index: %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestSaveLoadIndex(t *testing.T) {
+	cd := newIndexDetector(t)
+	expected := getClones(t, cd)
+
+	loaded, err := clone.LoadIndex(&clone.Config{Threshold: 10, MaxGap: 10}, bytes.NewReader(saveIndex(t, cd)))
+	if err != nil {
+		t.Fatalf("failed to load index: %v", err)
+	}
+
+	actual := getClones(t, loaded)
+	if !reflect.DeepEqual(clonePositionStrings(expected), clonePositionStrings(actual)) {
+		t.Fatalf("clones differ after loading:\nexpected %v\nactual   %v", clonePositionStrings(expected), clonePositionStrings(actual))
+	}
+	for _, clonePair := range actual {
+		if clonePair.Node1 != nil || clonePair.Type == clone.CloneType1 || clonePair.Type == clone.CloneType2 {
+			t.Errorf("clone loaded from an index has an AST: %s %s", clonePair.Fragment1, clonePair.Fragment2)
+		}
+	}
+
+	// 読み込んだ後に追加し直したファイルはASTを持ち、他のファイルとのクローンも見つかる
+	err = loaded.ReplaceFile(context.Background(), parseSource(t, loaded, source{"b.go", countSource}))
+	if err != nil {
+		t.Fatalf("failed to replace file: %v", err)
+	}
+
+	if !reflect.DeepEqual(clonePositionStrings(expected), clonePositionStrings(getClones(t, loaded))) {
+		t.Errorf("clones differ after replacing a file:\nexpected %v\nactual   %v", clonePositionStrings(expected), clonePositionStrings(getClones(t, loaded)))
+	}
+}
+
+func TestSaveLoadIndexSubtrees(t *testing.T) {
+	cd := newSourceDetector(t, clone.Config{Threshold: 10},
+		source{"c.go", sumSource},
+		source{"d.go", countSource},
+	)
+
+	// 同じファイルの関数を1つずつ追加したものも、ファイルごとに読み込める
+	file, err := parser.ParseFile(cd.FileSet(), "a.go", sumSource+countSource[len("package p\n"):], 0)
+	if err != nil {
+		t.Fatalf("failed to parse a.go: %v", err)
+	}
+	for _, decl := range file.Decls {
+		err := cd.AddNode(context.Background(), decl)
+		if err != nil {
+			t.Fatalf("failed to add a declaration of a.go: %v", err)
+		}
+	}
+	expected := clonePositionStrings(getClones(t, cd))
+
+	loaded, err := clone.LoadIndex(&clone.Config{Threshold: 10}, bytes.NewReader(saveIndex(t, cd)))
+	if err != nil {
+		t.Fatalf("failed to load index: %v", err)
+	}
+	actual := clonePositionStrings(getClones(t, loaded))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("clones differ after loading:\nexpected %v\nactual   %v", expected, actual)
+	}
+
+	err = loaded.RemoveFile("a.go")
+	if err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+	files := fragmentFiles(getClones(t, loaded))
+	if len(files) != 1 || files[0] != "c.go d.go" {
+		t.Errorf("unexpected clones after removing a.go: %v", files)
+	}
+}
+
+func TestLoadIndexASTRequired(t *testing.T) {
+	data := saveIndex(t, newIndexDetector(t))
+
+	for _, config := range []*clone.Config{
+		{Threshold: 10, ParameterizedMatch: true},
+		{Threshold: 10, Granularity: clone.GranularityFunction},
+		{Threshold: 10, Granularity: clone.GranularityStatementSequence},
+	} {
+		_, err := clone.LoadIndex(config, bytes.NewReader(data))
+		if !errors.Is(err, clone.ErrASTRequired) {
+			t.Errorf("unexpected error loading an index with %+v: %v", config, err)
+		}
+	}
+
+	// ノードの種類だけで決まる粒度は使える
+	_, err := clone.LoadIndex(&clone.Config{Threshold: 10, Granularity: clone.GranularityBlock}, bytes.NewReader(data))
+	if err != nil {
+		t.Errorf("failed to load index with block granularity: %v", err)
+	}
+}
+
+func TestLoadIndexInvalidFile(t *testing.T) {
+	data := saveIndex(t, newIndexDetector(t))
+
+	// ヘッダーのファイルの位置を書き換えたインデックスを作る
+	type indexFile struct {
+		Name     string
+		Document int
+		Base     int
+		Size     int
+		Lines    []int
+	}
+	type indexHeader struct {
+		Version   int
+		MatchMode uint8
+		Files     []*indexFile
+	}
+
+	r := bytes.NewReader(data[len("GCDINDEX"):])
+	var header indexHeader
+	err := gob.NewDecoder(r).Decode(&header)
+	if err != nil {
+		t.Fatalf("failed to decode index header: %v", err)
+	}
+	rest := data[len(data)-r.Len():]
+
+	for name, modify := range map[string]func(file *indexFile){
+		"base before file set": func(file *indexFile) { file.Base = 0 },
+		"negative size":        func(file *indexFile) { file.Size = -1 },
+		"overflowing size":     func(file *indexFile) { file.Size = int(^uint(0) >> 1) },
+	} {
+		files := make([]*indexFile, 0, len(header.Files))
+		for _, file := range header.Files {
+			copied := *file
+			files = append(files, &copied)
+		}
+		modify(files[len(files)-1])
+
+		var buf bytes.Buffer
+		buf.WriteString("GCDINDEX")
+		err := gob.NewEncoder(&buf).Encode(&indexHeader{Version: header.Version, MatchMode: header.MatchMode, Files: files})
+		if err != nil {
+			t.Fatalf("failed to encode index header: %v", err)
+		}
+		buf.Write(rest)
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("panic loading index with %s: %v", name, r)
+				}
+			}()
+
+			_, err := clone.LoadIndex(&clone.Config{Threshold: 10}, &buf)
+			if !errors.Is(err, clone.ErrUnsupportedIndex) {
+				t.Errorf("unexpected error loading index with %s: %v", name, err)
+			}
+		}()
+	}
+
+	_, err = clone.LoadIndex(&clone.Config{Threshold: 10}, bytes.NewReader(data[:len(data)/2]))
+	if err == nil {
+		t.Error("no error loading a truncated index")
+	}
+
+	_, err = clone.LoadIndex(&clone.Config{Threshold: 10}, bytes.NewReader([]byte("GCDSTREE")))
+	if !errors.Is(err, clone.ErrUnsupportedIndex) {
+		t.Errorf("unexpected error loading a file that is not an index: %v", err)
+	}
+}
+
+func TestSaveIndexNotSupported(t *testing.T) {
+	cd := newSourceDetector(t, clone.Config{Threshold: 10, SuffixTree: sarray.NewSuffixArray()},
+		source{"a.go", sumSource},
+		source{"b.go", countSource},
+	)
+
+	err := cd.SaveIndex(&bytes.Buffer{})
+	if !errors.Is(err, clone.ErrSaveNotSupported) {
+		t.Errorf("unexpected error saving an index of the suffix array: %v", err)
+	}
+}
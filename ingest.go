@@ -0,0 +1,170 @@
+package clone
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"runtime"
+	"sync/atomic"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"golang.org/x/sync/errgroup"
+)
+
+/*
+AddFiles filenamesのファイルを並行にパース・変換し、filenamesの順に追加する
+追加の順序は変わらないので、AddNodeで1つずつ追加した場合と同じ結果になる
+*/
+func (cd *CloneDetector) AddFiles(ctx context.Context, filenames []string) error {
+	return cd.addConcurrently(ctx, len(filenames), func(i int) (ast.Node, error) {
+		file, err := parser.ParseFile(cd.fset, filenames[i], nil, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse file: %w", err)
+		}
+
+		return file, nil
+	})
+}
+
+// AddNodes rootsを並行に変換し、rootsの順に追加する
+func (cd *CloneDetector) AddNodes(ctx context.Context, roots []ast.Node) error {
+	return cd.addConcurrently(ctx, len(roots), func(i int) (ast.Node, error) {
+		if roots[i] == nil {
+			return nil, fmt.Errorf("root node %d is nil", i)
+		}
+
+		err := cd.checkRoot(roots[i])
+		if err != nil {
+			return nil, err
+		}
+
+		return roots[i], nil
+	})
+}
+
+/*
+addConcurrently load(0)からload(n-1)までのASTを並行に変換し、変換したノード列を順に接尾辞木へ追加する
+SuffixTreeは並行に使えないので、追加は1つのgoroutineで行う
+追加を待つノード列が増えすぎないよう、変換を始めてから追加し終えるまでのASTの数を制限する
+*/
+func (cd *CloneDetector) addConcurrently(ctx context.Context, n int, load func(i int) (ast.Node, error)) error {
+	concurrency := cd.config.Concurrency
+	if concurrency <= 0 {
+		concurrency = runtime.GOMAXPROCS(0)
+	}
+
+	type serialized struct {
+		root  ast.Node
+		nodes []*domain.Node
+	}
+	results := make([]chan *serialized, n)
+	for i := range results {
+		results[i] = make(chan *serialized, 1)
+	}
+
+	slots := make(chan struct{}, 2*concurrency)
+	var next int64
+
+	eg, egCtx := errgroup.WithContext(ctx)
+	for w := 0; w < concurrency; w++ {
+		eg.Go(func() error {
+			for {
+				select {
+				case <-egCtx.Done():
+					return nil
+				case slots <- struct{}{}:
+				}
+
+				// 添字の小さい順に取るので、追加を待っているASTは必ず変換中か変換済みになる
+				i := int(atomic.AddInt64(&next, 1) - 1)
+				if i >= n {
+					return nil
+				}
+
+				root, err := load(i)
+				if err != nil {
+					return err
+				}
+
+				nodes, err := cd.serialize(egCtx, root)
+				if err != nil {
+					return err
+				}
+
+				results[i] <- &serialized{
+					root:  root,
+					nodes: nodes,
+				}
+			}
+		})
+	}
+
+	eg.Go(func() error {
+		for _, result := range results {
+			var s *serialized
+			select {
+			case <-egCtx.Done():
+				return egCtx.Err()
+			case s = <-result:
+			}
+
+			for _, node := range s.nodes {
+				err := cd.suffixTree.AddNode(node)
+				if err != nil {
+					return fmt.Errorf("suffix tree error: %w", err)
+				}
+			}
+
+			err := cd.closeDocument(s.root)
+			if err != nil {
+				return err
+			}
+
+			<-slots
+		}
+
+		return nil
+	})
+
+	return eg.Wait()
+}
+
+// serialize 接尾辞木には追加せずにASTをノード列に変換する
+func (cd *CloneDetector) serialize(ctx context.Context, root ast.Node) ([]*domain.Node, error) {
+	nodeChan := make(chan *domain.Node, cd.config.BufSize)
+
+	nodes := []*domain.Node{}
+	eg, egCtx := errgroup.WithContext(ctx)
+	eg.Go(func() error {
+		defer close(nodeChan)
+
+		err := cd.serializer.Serialize(egCtx, root, nodeChan)
+		if err != nil {
+			return fmt.Errorf("serialization error: %w", err)
+		}
+
+		return nil
+	})
+
+	eg.Go(func() error {
+		for node := range nodeChan {
+			nodes = append(nodes, node)
+		}
+
+		return nil
+	})
+
+	err := eg.Wait()
+	if err != nil {
+		return nil, err
+	}
+
+	// キャンセルされた場合は途中までしか変換されていない
+	err = ctx.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return nodes, nil
+}
@@ -0,0 +1,94 @@
+package clone_test
+
+import (
+	"fmt"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/serializer"
+)
+
+// modeSource exprだけが異なる関数
+func modeSource(expr string) string {
+	return fmt.Sprintf(`package p
+
+func f(x, y int) int {
+	v := %s
+	if v > 10 {
+		v -= 10
+	}
+	for i := 0; i < v; i++ {
+		v += i
+	}
+	return v
+}
+`, expr)
+}
+
+func TestMatchMode(t *testing.T) {
+	tests := []struct {
+		description string
+		mode        serializer.Mode
+		expr        string
+		expected    bool
+	}{
+		{
+			description: "default mode matches different identifiers",
+			mode:        0,
+			expr:        "y + 1",
+			expected:    true,
+		},
+		{
+			description: "default mode matches different literals",
+			mode:        0,
+			expr:        "x + 2",
+			expected:    true,
+		},
+		{
+			description: "identifier mode separates different identifiers",
+			mode:        serializer.ModeIdentifier,
+			expr:        "y + 1",
+			expected:    false,
+		},
+		{
+			description: "identifier mode matches different literals",
+			mode:        serializer.ModeIdentifier,
+			expr:        "x + 2",
+			expected:    true,
+		},
+		{
+			description: "literal mode separates different literals",
+			mode:        serializer.ModeLiteral,
+			expr:        "x + 2",
+			expected:    false,
+		},
+		{
+			description: "literal mode matches different identifiers",
+			mode:        serializer.ModeLiteral,
+			expr:        "y + 1",
+			expected:    true,
+		},
+		{
+			description: "both modes match the same expression",
+			mode:        serializer.ModeIdentifier | serializer.ModeLiteral,
+			expr:        "x + 1",
+			expected:    true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			cd := newSourceDetector(t, clone.Config{Threshold: 10, MatchMode: test.mode},
+				source{"a.go", modeSource("x + 1")},
+				source{"b.go", modeSource(test.expr)},
+			)
+
+			// ファイル全体のクローンは、式が一致するとみなされる場合のみ見つかる
+			clonePair := findClone(getClones(t, cd), "a.go", 1, "b.go", 1)
+			if (clonePair != nil) != test.expected {
+				t.Errorf("x + 1 and %s: expected clone %t, actual %t", test.expr, test.expected, clonePair != nil)
+			}
+		})
+	}
+}
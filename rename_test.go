@@ -0,0 +1,112 @@
+package clone
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+)
+
+// parseBody bodyを関数の本体としてパースする(引数は宣言済みの識別子として解決される)
+func parseBody(t *testing.T, body string) []ast.Node {
+	t.Helper()
+
+	src := "package p\n\nfunc f(a, b, c, d, v, w T, xs, ys []int) {\n" + body + "\n}\n"
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse %q: %v", body, err)
+	}
+
+	return []ast.Node{file.Decls[0].(*ast.FuncDecl).Body}
+}
+
+func TestIsParameterizedMatch(t *testing.T) {
+	tests := []struct {
+		description  string
+		body1, body2 string
+		expected     bool
+	}{
+		{
+			description: "consistent renaming",
+			body1:       "x := a + b\nprintln(x)",
+			body2:       "y := c + d\nprintln(y)",
+			expected:    true,
+		},
+		{
+			description: "inconsistent renaming",
+			body1:       "x := a + b\nprintln(x)",
+			body2:       "y := c + d\nprintln(c)",
+			expected:    false,
+		},
+		{
+			description: "same method on renamed receivers",
+			body1:       "_ = v.Len()",
+			body2:       "_ = w.Len()",
+			expected:    true,
+		},
+		{
+			description: "different methods",
+			body1:       "_ = v.Len()",
+			body2:       "_ = w.Size()",
+			expected:    false,
+		},
+		{
+			description: "different fields",
+			body1:       "v.count++",
+			body2:       "v.total++",
+			expected:    false,
+		},
+		{
+			description: "same package",
+			body1:       "fmt.Println(a)",
+			body2:       "fmt.Println(b)",
+			expected:    true,
+		},
+		{
+			description: "different packages",
+			body1:       "fmt.Println(a)",
+			body2:       "log.Println(a)",
+			expected:    false,
+		},
+		{
+			description: "same builtin",
+			body1:       "_ = len(xs)",
+			body2:       "_ = len(ys)",
+			expected:    true,
+		},
+		{
+			description: "different builtins",
+			body1:       "_ = len(xs)",
+			body2:       "_ = cap(xs)",
+			expected:    false,
+		},
+		{
+			description: "different builtin types",
+			body1:       "_ = int(a)",
+			body2:       "_ = int64(a)",
+			expected:    false,
+		},
+		{
+			description: "different constants",
+			body1:       "_ = a == nil",
+			body2:       "_ = a == true",
+			expected:    false,
+		},
+		{
+			description: "shadowed builtin",
+			body1:       "len := a\nprintln(len)",
+			body2:       "n := a\nprintln(n)",
+			expected:    true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			actual := isParameterizedMatch(parseBody(t, test.body1), parseBody(t, test.body2))
+			if actual != test.expected {
+				t.Errorf("%q and %q: expected %t, actual %t", test.body1, test.body2, test.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,22 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// WriteJSON クローンの一覧をJSON形式のレポートとして書き出す
+func WriteJSON(w io.Writer, clonePairs []*clone.ClonePair) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(NewReport(clonePairs))
+	if err != nil {
+		return fmt.Errorf("failed to encode json report: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package report_test
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"go/parser"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/report"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+const sumSource = `package p
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`
+
+const countSource = `package p
+
+func count(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	return n
+}
+`
+
+// detectClones 同じ関数を含むファイルと、名前だけが異なる関数を含むファイルからクローンを検出する
+func detectClones(t *testing.T) []*clone.ClonePair {
+	t.Helper()
+
+	cd := clone.NewCloneDetector(&clone.Config{Threshold: 10})
+	sources := []struct {
+		filename string
+		src      string
+	}{
+		{"a.go", sumSource},
+		{"b.go", sumSource},
+		{"c.go", countSource},
+	}
+	for _, s := range sources {
+		file, err := parser.ParseFile(cd.FileSet(), s.filename, s.src, 0)
+		if err != nil {
+			t.Fatalf("failed to parse %s: %v", s.filename, err)
+		}
+
+		err = cd.AddNode(context.Background(), file)
+		if err != nil {
+			t.Fatalf("failed to add %s: %v", s.filename, err)
+		}
+	}
+
+	clonePairs, err := cd.GetClones()
+	if err != nil {
+		t.Fatalf("failed to get clones: %v", err)
+	}
+	if len(clonePairs) == 0 {
+		t.Fatal("no clones found")
+	}
+
+	// 出力の順を検出の順に依存させない
+	sort.Slice(clonePairs, func(i, j int) bool {
+		key1 := clonePairs[i].Fragment1.String() + " " + clonePairs[i].Fragment2.String()
+		key2 := clonePairs[j].Fragment1.String() + " " + clonePairs[j].Fragment2.String()
+		return key1 < key2
+	})
+
+	return clonePairs
+}
+
+func assertGolden(t *testing.T, golden string, actual []byte) {
+	t.Helper()
+
+	golden = filepath.Join("testdata", golden)
+	if *update {
+		err := os.WriteFile(golden, actual, 0o644)
+		if err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(expected, actual) {
+		t.Errorf("unexpected output:\nexpected\n%s\nactual\n%s", expected, actual)
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	var buf bytes.Buffer
+	err := report.WriteJSON(&buf, detectClones(t))
+	if err != nil {
+		t.Fatalf("failed to write json: %v", err)
+	}
+
+	assertGolden(t, "report.json.golden", buf.Bytes())
+}
@@ -0,0 +1,97 @@
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"go/ast"
+	"strings"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// Version レポートの形式のバージョン(互換性のない変更をしたときに上げる)
+const Version = 1
+
+type Report struct {
+	Version int      `json:"version"`
+	Clones  []*Clone `json:"clones"`
+}
+
+type Clone struct {
+	ID string `json:"id"`
+	// Type-1, Type-2, Type-3のいずれか(分類できなかった場合はUnknown)
+	Type string `json:"type"`
+	// 一致したノード数の割合(ギャップのないクローンは1)
+	Similarity float64 `json:"similarity"`
+	// 各コード片に含まれるASTノード数
+	Length    int         `json:"length"`
+	Fragments []*Fragment `json:"fragments"`
+}
+
+type Fragment struct {
+	ID          string `json:"id"`
+	File        string `json:"file"`
+	StartLine   int    `json:"startLine"`
+	StartColumn int    `json:"startColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+	// コード片の根のASTノードの種類(FuncDecl, BlockStmtなど、複数の部分木からなる場合はSequence)
+	Kind string `json:"kind"`
+}
+
+func NewReport(clonePairs []*clone.ClonePair) *Report {
+	clones := make([]*Clone, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		fragment1 := newFragment(clonePair.Fragment1)
+		fragment2 := newFragment(clonePair.Fragment2)
+
+		clones = append(clones, &Clone{
+			ID:         hashID(fragment1.ID, fragment2.ID),
+			Type:       clonePair.Type.String(),
+			Similarity: clonePair.Similarity,
+			Length:     clonePair.Fragment1.TokenCount,
+			Fragments:  []*Fragment{fragment1, fragment2},
+		})
+	}
+
+	return &Report{
+		Version: Version,
+		Clones:  clones,
+	}
+}
+
+func newFragment(fragment *clone.Fragment) *Fragment {
+	return &Fragment{
+		ID:          hashID(fragment.String()),
+		File:        fragment.Filename,
+		StartLine:   fragment.StartLine,
+		StartColumn: fragment.StartColumn,
+		EndLine:     fragment.EndLine,
+		EndColumn:   fragment.EndColumn,
+		Kind:        nodeKind(fragment.Nodes),
+	}
+}
+
+func nodeKind(nodes []ast.Node) string {
+	switch {
+	case len(nodes) == 0 || nodes[0] == nil:
+		return ""
+	case len(nodes) > 1:
+		return "Sequence"
+	}
+
+	return strings.TrimPrefix(fmt.Sprintf("%T", nodes[0]), "*ast.")
+}
+
+// hashID 位置情報などから実行ごとに変わらないIDを作る
+func hashID(values ...string) string {
+	hash := sha256.New()
+	for _, value := range values {
+		// 区切りを入れないと("ab", "c")と("a", "bc")が同じになる
+		hash.Write([]byte(value))
+		hash.Write([]byte{0})
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)[:8])
+}
@@ -0,0 +1,227 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+const (
+	sarifVersion = "2.1.0"
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	toolName     = "go-clone-detection"
+	toolURI      = "https://github.com/mazrean/go-clone-detection"
+	// 正規化されたノード列と2つのコード片の位置から作る、実行ごとに変わらない指紋
+	fingerprintKey = "cloneTokenSequenceHash/v1"
+)
+
+type sarifRuleDefinition struct {
+	id          string
+	name        string
+	description string
+}
+
+// sarifRules クローンの種類ごとのルール
+var sarifRules = []*sarifRuleDefinition{
+	{
+		id:          "type-1-clone",
+		name:        "ExactClone",
+		description: "Code fragments identical except for whitespace and comments.",
+	},
+	{
+		id:          "type-2-clone",
+		name:        "RenamedClone",
+		description: "Syntactically identical code fragments except for identifiers and literals.",
+	},
+	{
+		id:          "type-3-clone",
+		name:        "GappedClone",
+		description: "Similar code fragments with added, removed or changed statements.",
+	},
+}
+
+func cloneRule(clonePair *clone.ClonePair) *sarifRuleDefinition {
+	switch clonePair.Type {
+	case clone.CloneType1:
+		return sarifRules[0]
+	case clone.CloneType3:
+		return sarifRules[2]
+	}
+
+	// 分類できなかったものは、検出時に保証されるType-2として扱う
+	return sarifRules[1]
+}
+
+type sarifLog struct {
+	Version string      `json:"version"`
+	Schema  string      `json:"$schema"`
+	Runs    []*sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    *sarifTool     `json:"tool"`
+	Results []*sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver *sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string       `json:"name"`
+	InformationURI string       `json:"informationUri"`
+	Rules          []*sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string        `json:"id"`
+	Name             string        `json:"name"`
+	ShortDescription *sarifMessage `json:"shortDescription"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             *sarifMessage     `json:"message"`
+	Locations           []*sarifLocation  `json:"locations"`
+	RelatedLocations    []*sarifLocation  `json:"relatedLocations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	ID               *int                   `json:"id,omitempty"`
+	PhysicalLocation *sarifPhysicalLocation `json:"physicalLocation"`
+	Message          *sarifMessage          `json:"message,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation *sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+/*
+sarifFingerprint 出力の順やコード片の順に依存しない指紋を作る
+同じファイル間に同じ構造のクローンが複数あっても、位置が異なるので重ならない
+*/
+func sarifFingerprint(clonePair *clone.ClonePair) string {
+	fragment1, fragment2 := clonePair.Fragment1.String(), clonePair.Fragment2.String()
+	if fragment1 > fragment2 {
+		fragment1, fragment2 = fragment2, fragment1
+	}
+
+	return hashID(clonePair.Fingerprint, fragment1, fragment2)
+}
+
+// WriteSARIF クローンの一覧をSARIF 2.1.0形式で書き出す
+func WriteSARIF(w io.Writer, clonePairs []*clone.ClonePair) error {
+	rules := make([]*sarifRule, 0, len(sarifRules))
+	ruleIndexes := make(map[string]int, len(sarifRules))
+	for i, rule := range sarifRules {
+		rules = append(rules, &sarifRule{
+			ID:               rule.id,
+			Name:             rule.name,
+			ShortDescription: &sarifMessage{Text: rule.description},
+		})
+		ruleIndexes[rule.id] = i
+	}
+
+	results := make([]*sarifResult, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		rule := cloneRule(clonePair)
+
+		relatedID := 0
+		relatedLocation := newSARIFLocation(clonePair.Fragment2)
+		relatedLocation.ID = &relatedID
+		relatedLocation.Message = &sarifMessage{Text: "other copy"}
+
+		results = append(results, &sarifResult{
+			RuleID:    rule.id,
+			RuleIndex: ruleIndexes[rule.id],
+			Level:     "note",
+			Message: &sarifMessage{
+				Text: fmt.Sprintf(
+					"%s code clone of [%s](%d) (%d nodes).",
+					clonePair.Type,
+					clonePair.Fragment2,
+					relatedID,
+					clonePair.Fragment1.TokenCount,
+				),
+			},
+			Locations:        []*sarifLocation{newSARIFLocation(clonePair.Fragment1)},
+			RelatedLocations: []*sarifLocation{relatedLocation},
+			PartialFingerprints: map[string]string{
+				fingerprintKey: sarifFingerprint(clonePair),
+			},
+		})
+	}
+
+	log := &sarifLog{
+		Version: sarifVersion,
+		Schema:  sarifSchema,
+		Runs: []*sarifRun{
+			{
+				Tool: &sarifTool{
+					Driver: &sarifDriver{
+						Name:           toolName,
+						InformationURI: toolURI,
+						Rules:          rules,
+					},
+				},
+				Results: results,
+			},
+		},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	err := encoder.Encode(log)
+	if err != nil {
+		return fmt.Errorf("failed to encode sarif log: %w", err)
+	}
+
+	return nil
+}
+
+func newSARIFLocation(fragment *clone.Fragment) *sarifLocation {
+	artifactLocation := &sarifArtifactLocation{
+		URI: filepath.ToSlash(fragment.Filename),
+	}
+	if filepath.IsAbs(fragment.Filename) {
+		artifactLocation.URI = "file://" + artifactLocation.URI
+	} else {
+		artifactLocation.URIBaseID = "%SRCROOT%"
+	}
+
+	return &sarifLocation{
+		PhysicalLocation: &sarifPhysicalLocation{
+			ArtifactLocation: artifactLocation,
+			Region: &sarifRegion{
+				StartLine:   fragment.StartLine,
+				StartColumn: fragment.StartColumn,
+				EndLine:     fragment.EndLine,
+				EndColumn:   fragment.EndColumn,
+			},
+		},
+	}
+}
@@ -0,0 +1,148 @@
+package report_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+	"github.com/mazrean/go-clone-detection/report"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	var buf bytes.Buffer
+	err := report.WriteSARIF(&buf, detectClones(t))
+	if err != nil {
+		t.Fatalf("failed to write sarif: %v", err)
+	}
+
+	assertGolden(t, "report.sarif.golden", buf.Bytes())
+}
+
+// sarifFingerprints clonePairsをSARIF形式で書き出し、結果ごとの指紋を返す
+func sarifFingerprints(t *testing.T, clonePairs []*clone.ClonePair) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := report.WriteSARIF(&buf, clonePairs)
+	if err != nil {
+		t.Fatalf("failed to write sarif: %v", err)
+	}
+
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				PartialFingerprints map[string]string `json:"partialFingerprints"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &log)
+	if err != nil {
+		t.Fatalf("failed to decode sarif: %v", err)
+	}
+
+	fingerprints := []string{}
+	for _, result := range log.Runs[0].Results {
+		if len(result.PartialFingerprints) != 1 {
+			t.Fatalf("unexpected partial fingerprints: %v", result.PartialFingerprints)
+		}
+
+		for _, fingerprint := range result.PartialFingerprints {
+			fingerprints = append(fingerprints, fingerprint)
+		}
+	}
+
+	return fingerprints
+}
+
+func TestSARIFFingerprint(t *testing.T) {
+	newClonePair := func(filename1 string, line1 int, filename2 string, line2 int) *clone.ClonePair {
+		return &clone.ClonePair{
+			Fragment1:   &clone.Fragment{Filename: filename1, StartLine: line1, EndLine: line1 + 5, TokenCount: 20},
+			Fragment2:   &clone.Fragment{Filename: filename2, StartLine: line2, EndLine: line2 + 5, TokenCount: 20},
+			Fingerprint: "fingerprint",
+		}
+	}
+
+	first := newClonePair("a.go", 3, "b.go", 10)
+	second := newClonePair("a.go", 20, "b.go", 30)
+
+	fingerprints := sarifFingerprints(t, []*clone.ClonePair{first, second})
+	if fingerprints[0] == fingerprints[1] {
+		t.Error("clones with the same structure in the same files share a fingerprint")
+	}
+
+	// 出力の順が変わっても、同じクローンの指紋は変わらない
+	reordered := sarifFingerprints(t, []*clone.ClonePair{second, first})
+	if reordered[0] != fingerprints[1] || reordered[1] != fingerprints[0] {
+		t.Error("fingerprints depend on the output order")
+	}
+
+	// コード片の順が入れ替わっても、同じクローンの指紋は変わらない
+	swapped := sarifFingerprints(t, []*clone.ClonePair{newClonePair("b.go", 10, "a.go", 3)})
+	if swapped[0] != fingerprints[0] {
+		t.Error("fingerprints depend on the order of the fragments")
+	}
+}
+
+func TestSARIFRegion(t *testing.T) {
+	clonePair := &clone.ClonePair{
+		Fragment1:   &clone.Fragment{Filename: "a.go", StartLine: 3, StartColumn: 28, EndLine: 11, EndColumn: 2, TokenCount: 20},
+		Fragment2:   &clone.Fragment{Filename: "dir/b.go", StartLine: 4, StartColumn: 8, EndLine: 12, EndColumn: 3, TokenCount: 20},
+		Fingerprint: "fingerprint",
+	}
+
+	var buf bytes.Buffer
+	err := report.WriteSARIF(&buf, []*clone.ClonePair{clonePair})
+	if err != nil {
+		t.Fatalf("failed to write sarif: %v", err)
+	}
+
+	type location struct {
+		PhysicalLocation struct {
+			ArtifactLocation struct {
+				URI string `json:"uri"`
+			} `json:"artifactLocation"`
+			Region struct {
+				StartLine   int `json:"startLine"`
+				StartColumn int `json:"startColumn"`
+				EndLine     int `json:"endLine"`
+				EndColumn   int `json:"endColumn"`
+			} `json:"region"`
+		} `json:"physicalLocation"`
+	}
+	var log struct {
+		Runs []struct {
+			Results []struct {
+				Locations        []location `json:"locations"`
+				RelatedLocations []location `json:"relatedLocations"`
+			} `json:"results"`
+		} `json:"runs"`
+	}
+	err = json.Unmarshal(buf.Bytes(), &log)
+	if err != nil {
+		t.Fatalf("failed to decode sarif: %v", err)
+	}
+
+	result := log.Runs[0].Results[0]
+	for _, test := range []struct {
+		location location
+		fragment *clone.Fragment
+	}{
+		{result.Locations[0], clonePair.Fragment1},
+		{result.RelatedLocations[0], clonePair.Fragment2},
+	} {
+		physicalLocation := test.location.PhysicalLocation
+		region := physicalLocation.Region
+		actual := &clone.Fragment{
+			Filename:    physicalLocation.ArtifactLocation.URI,
+			StartLine:   region.StartLine,
+			StartColumn: region.StartColumn,
+			EndLine:     region.EndLine,
+			EndColumn:   region.EndColumn,
+		}
+		if actual.String() != test.fragment.String() {
+			t.Errorf("unexpected region: expected %s, actual %s", test.fragment, actual)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package sarray
+
+import "sort"
+
+/*
+interval LCP配列上の区間(lcp-interval)
+接尾辞配列の[lb, rb]の接尾辞が共通接頭辞lcpを持ち、接尾辞木の内部ノード1つに対応する
+*/
+type interval struct {
+	lcp      int32
+	lb, rb   int
+	children []*interval
+}
+
+// groupEnd 接尾辞配列のi番目の接尾辞を含む子区間の末尾(子区間に含まれない場合はi)
+func (in *interval) groupEnd(i int) int {
+	j := sort.Search(len(in.children), func(j int) bool {
+		return in.children[j].rb >= i
+	})
+	if j < len(in.children) && in.children[j].lb <= i {
+		return in.children[j].rb
+	}
+
+	return i
+}
+
+/*
+walkIntervals 根以外の全てのlcp-intervalを帰りがけ順に訪れる
+Abouelhodaらのボトムアップな走査で、子区間を持たせながらスタックで辿る
+visitがエラーを返した場合は、そこで辿るのをやめてそのエラーを返す
+*/
+func (sa *SuffixArray) walkIntervals(visit func(in *interval) error) error {
+	n := len(sa.suffixArray)
+	if n == 0 {
+		return nil
+	}
+
+	stack := []*interval{{lcp: 0, lb: 0}}
+	for i := 1; i <= n; i++ {
+		// 末尾では根以外の区間を全て閉じる
+		var lcp int32
+		if i < n {
+			lcp = sa.lcpArray[i]
+		}
+
+		lb := i - 1
+		var last *interval
+		for lcp < stack[len(stack)-1].lcp {
+			last = stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			last.rb = i - 1
+			err := visit(last)
+			if err != nil {
+				return err
+			}
+			lb = last.lb
+
+			top := stack[len(stack)-1]
+			if lcp <= top.lcp {
+				top.children = append(top.children, last)
+				last = nil
+			}
+		}
+
+		if lcp > stack[len(stack)-1].lcp {
+			in := &interval{lcp: lcp, lb: lb}
+			if last != nil {
+				in.children = []*interval{last}
+			}
+			stack = append(stack, in)
+		}
+	}
+
+	return nil
+}
+
+/*
+buildSuffixArray 接頭辞倍加法で接尾辞配列を作る
+各段階で(先頭k個の順位, 次のk個の順位)の組を基数ソートするのでO(n log n)
+*/
+func buildSuffixArray(text []int32, alphabetSize int) []int32 {
+	n := len(text)
+	suffixArray := make([]int32, n)
+	if n == 0 {
+		return suffixArray
+	}
+
+	rank := make([]int32, n)
+	copy(rank, text)
+	tmp := make([]int32, n)
+	newRank := make([]int32, n)
+
+	classNum := alphabetSize
+	for i := range tmp {
+		tmp[i] = int32(i)
+	}
+	countingSort(tmp, suffixArray, rank, classNum)
+
+	for k := 1; ; k <<= 1 {
+		// 次のk個の順位の順に並べる(はみ出すものが最も小さい)
+		p := 0
+		for i := n - k; i < n; i++ {
+			if i >= 0 {
+				tmp[p] = int32(i)
+				p++
+			}
+		}
+		for _, suffix := range suffixArray {
+			if int(suffix) >= k {
+				tmp[p] = suffix - int32(k)
+				p++
+			}
+		}
+
+		// 先頭k個の順位で安定にソートする
+		countingSort(tmp, suffixArray, rank, classNum)
+
+		second := func(i int32) int32 {
+			if int(i)+k < n {
+				return rank[int(i)+k]
+			}
+			return -1
+		}
+
+		newRank[suffixArray[0]] = 0
+		for i := 1; i < n; i++ {
+			current, prev := suffixArray[i], suffixArray[i-1]
+			newRank[current] = newRank[prev]
+			if rank[current] != rank[prev] || second(current) != second(prev) {
+				newRank[current]++
+			}
+		}
+		rank, newRank = newRank, rank
+		classNum = int(rank[suffixArray[n-1]]) + 1
+
+		if classNum == n || k >= n {
+			break
+		}
+	}
+
+	return suffixArray
+}
+
+// countingSort srcをkeysの値で安定にソートしてdstに書き込む
+func countingSort(src, dst, keys []int32, keyNum int) {
+	counts := make([]int, keyNum+1)
+	for _, i := range src {
+		counts[keys[i]+1]++
+	}
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+
+	for _, i := range src {
+		dst[counts[keys[i]]] = i
+		counts[keys[i]]++
+	}
+}
+
+// buildLCPArray Kasaiらの方法で、接尾辞配列上で隣り合う接尾辞の最長共通接頭辞の長さを求める
+func buildLCPArray(text []int32, suffixArray []int32) []int32 {
+	n := len(text)
+	inverse := make([]int32, n)
+	for i, suffix := range suffixArray {
+		inverse[suffix] = int32(i)
+	}
+
+	lcpArray := make([]int32, n)
+	h := 0
+	for i := 0; i < n; i++ {
+		if inverse[i] == 0 {
+			h = 0
+			continue
+		}
+
+		j := int(suffixArray[inverse[i]-1])
+		for i+h < n && j+h < n && text[i+h] == text[j+h] {
+			h++
+		}
+		lcpArray[inverse[i]] = int32(h)
+
+		if h > 0 {
+			h--
+		}
+	}
+
+	return lcpArray
+}
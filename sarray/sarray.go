@@ -0,0 +1,368 @@
+package sarray
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+)
+
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+)
+
+/*
+SuffixArray 接尾辞配列とLCP配列による一般化接尾辞木の代わり
+ノードを記号に置き換えた列の接尾辞配列を、クローンの検出時にまとめて作る
+接尾辞木の内部ノードはLCP配列上の区間(lcp-interval)として辿る
+*/
+type SuffixArray struct {
+	domainNodes []*domain.Node
+	// domainNodesの各ノードの記号
+	symbols   []int32
+	symbolMap map[symbolKey]int32
+	// domainNodes上の位置の順に並んだ入力(最後の要素は終端前の入力)
+	documents []*document
+	removed   bool
+	// 接尾辞配列とLCP配列(domainNodesが変わったときにnilにする)
+	suffixArray []int32
+	lcpArray    []int32
+}
+
+const (
+	// noSymbol 追加したどのノードとも一致しないノードの記号
+	noSymbol int32 = -1
+	// endSymbol 接尾辞の末尾より後ろの位置の記号(どの記号よりも前に並ぶ)
+	endSymbol int32 = -2
+)
+
+// symbolKey 同じノードとみなすノードの属性(stree.compareNodesで比較するもの)
+type symbolKey struct {
+	nodeType   values.NodeType
+	token      values.NodeToken
+	childCount values.ChildCount
+	value      values.NodeValue
+}
+
+// document 接尾辞配列に追加された入力1つ分
+type document struct {
+	id int
+	// domainNodes上の先頭の位置
+	start   int64
+	removed bool
+}
+
+func newDocument(id int, start int64) *document {
+	return &document{
+		id:    id,
+		start: start,
+	}
+}
+
+func NewSuffixArray() *SuffixArray {
+	return &SuffixArray{
+		domainNodes: []*domain.Node{},
+		symbols:     []int32{},
+		symbolMap:   map[symbolKey]int32{},
+		documents:   []*document{newDocument(0, 0)},
+	}
+}
+
+func (sa *SuffixArray) AddNode(domainNode *domain.Node) error {
+	sa.domainNodes = append(sa.domainNodes, domainNode)
+	sa.symbols = append(sa.symbols, sa.getSymbol(domainNode, true))
+	sa.suffixArray, sa.lcpArray = nil, nil
+
+	return nil
+}
+
+// getSymbol ノードの記号(addがfalseで未知のノードの場合はnoSymbol)
+func (sa *SuffixArray) getSymbol(domainNode *domain.Node, add bool) int32 {
+	key := symbolKey{
+		nodeType:   domainNode.GetNodeType(),
+		token:      domainNode.GetToken(),
+		childCount: domainNode.GetChildCount(),
+		value:      domainNode.GetValue(),
+	}
+
+	symbol, ok := sa.symbolMap[key]
+	if !ok {
+		if !add {
+			return noSymbol
+		}
+
+		symbol = int32(len(sa.symbolMap))
+		sa.symbolMap[key] = symbol
+	}
+
+	return symbol
+}
+
+// CloseDocument 現在の入力に番兵ノードを追加して終端し、終端した入力のインデックスを返す
+func (sa *SuffixArray) CloseDocument() (int, error) {
+	document := sa.documents[len(sa.documents)-1]
+
+	err := sa.AddNode(domain.NewTerminalNode(document.id))
+	if err != nil {
+		return 0, fmt.Errorf("error adding terminal node: %w", err)
+	}
+
+	sa.documents = append(sa.documents, newDocument(document.id+1, int64(len(sa.domainNodes))))
+
+	return document.id, nil
+}
+
+/*
+RemoveDocument 終端済みの入力を削除する
+削除した入力のノードは、次に接尾辞配列を作るときに取り除く
+*/
+func (sa *SuffixArray) RemoveDocument(id int) error {
+	// 最後の要素は終端前の入力なので削除できない
+	i := sort.Search(len(sa.documents)-1, func(i int) bool {
+		return sa.documents[i].id >= id
+	})
+	if i == len(sa.documents)-1 || sa.documents[i].id != id || sa.documents[i].removed {
+		return ErrDocumentNotFound
+	}
+
+	sa.documents[i].removed = true
+	sa.removed = true
+	sa.suffixArray, sa.lcpArray = nil, nil
+
+	return nil
+}
+
+// getDocument domainNodes上の位置を含む入力
+func (sa *SuffixArray) getDocument(index int) *document {
+	i := sort.Search(len(sa.documents), func(i int) bool {
+		return sa.documents[i].start > int64(index)
+	})
+
+	return sa.documents[i-1]
+}
+
+// build 削除済みの入力を取り除き、接尾辞配列とLCP配列を作る
+func (sa *SuffixArray) build() {
+	if sa.suffixArray != nil {
+		return
+	}
+
+	if sa.removed {
+		sa.compact()
+	}
+
+	sa.suffixArray = buildSuffixArray(sa.symbols, len(sa.symbolMap))
+	sa.lcpArray = buildLCPArray(sa.symbols, sa.suffixArray)
+}
+
+// compact 削除済みの入力のノードをdomainNodesから取り除く(入力のインデックスは変えない)
+func (sa *SuffixArray) compact() {
+	domainNodes := make([]*domain.Node, 0, len(sa.domainNodes))
+	symbols := make([]int32, 0, len(sa.symbols))
+	documents := make([]*document, 0, len(sa.documents))
+	for i, document := range sa.documents {
+		end := int64(len(sa.domainNodes))
+		if i+1 < len(sa.documents) {
+			end = sa.documents[i+1].start
+		}
+
+		if document.removed {
+			continue
+		}
+
+		start := int64(len(domainNodes))
+		domainNodes = append(domainNodes, sa.domainNodes[document.start:end]...)
+		symbols = append(symbols, sa.symbols[document.start:end]...)
+		documents = append(documents, newDocument(document.id, start))
+	}
+
+	sa.domainNodes = domainNodes
+	sa.symbols = symbols
+	sa.documents = documents
+	sa.removed = false
+}
+
+func (sa *SuffixArray) GetClonePairs(threshold int) ([]*domain.CloneSequencePair, error) {
+	var clonePairs []*domain.CloneSequencePair
+	err := sa.EachClonePair(context.Background(), threshold, func(clonePair *domain.CloneSequencePair) error {
+		clonePairs = append(clonePairs, clonePair)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 辿る順は接尾辞木の形に依存するので、位置の順に並べ替える
+	domain.SortCloneSequencePairs(clonePairs)
+
+	return clonePairs, nil
+}
+
+/*
+EachClonePair GetClonePairsと同じクローンの組を、LCP配列を辿りながら見つけた順にyieldへ渡す
+yieldがエラーを返すかctxがキャンセルされた場合は、そこで辿るのをやめてそのエラーを返す
+*/
+func (sa *SuffixArray) EachClonePair(ctx context.Context, threshold int, yield func(*domain.CloneSequencePair) error) error {
+	sa.build()
+
+	return sa.walkIntervals(func(in *interval) error {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		if int(in.lcp) <= threshold {
+			return nil
+		}
+
+		// 同じ子区間にない接尾辞の組の最長共通接頭辞は、この区間のlcpになる
+		for i := in.lb; i <= in.rb; i++ {
+			for j := in.groupEnd(i) + 1; j <= in.rb; j++ {
+				leaf1, leaf2 := int(sa.suffixArray[i]), int(sa.suffixArray[j])
+				// 直前のノードが一致する組は、より長いクローンの一部
+				if leaf1 > 0 && leaf2 > 0 && sa.symbols[leaf1-1] == sa.symbols[leaf2-1] {
+					continue
+				}
+
+				err := yield(domain.NewCloneSequencePair(
+					sa.newCloneSequence(leaf1, int(in.lcp)),
+					sa.newCloneSequence(leaf2, int(in.lcp)),
+				))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (sa *SuffixArray) GetCloneClasses(threshold int) ([]*domain.CloneClass, error) {
+	sa.build()
+
+	var cloneClasses []*domain.CloneClass
+	err := sa.walkIntervals(func(in *interval) error {
+		if int(in.lcp) <= threshold {
+			return nil
+		}
+
+		leafs := make([]int, 0, in.rb-in.lb+1)
+		for i := in.lb; i <= in.rb; i++ {
+			leafs = append(leafs, int(sa.suffixArray[i]))
+		}
+
+		// 直前のノードが全て一致する場合はより長いクローンクラスの一部
+		if !sa.isLeftDiverse(leafs) {
+			return nil
+		}
+
+		sort.Ints(leafs)
+
+		sequences := make([]*domain.CloneSequence, 0, len(leafs))
+		for _, leaf := range leafs {
+			sequences = append(sequences, sa.newCloneSequence(leaf, int(in.lcp)))
+		}
+
+		cloneClasses = append(cloneClasses, domain.NewCloneClass(sequences))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	domain.SortCloneClasses(cloneClasses)
+
+	return cloneClasses, nil
+}
+
+/*
+FindMatches 入力中でqueryの一部と一致するノード列のうち、長さが閾値より大きいものを返す
+queryの各位置から一致する接尾辞の範囲を1ノードずつ二分探索で狭めていく
+直前のノードも一致するものは、queryの1つ前の位置からの一致に含まれるので除く
+*/
+func (sa *SuffixArray) FindMatches(query []*domain.Node, threshold int) ([]*domain.SequenceMatch, error) {
+	sa.build()
+
+	querySymbols := make([]int32, 0, len(query))
+	for _, domainNode := range query {
+		querySymbols = append(querySymbols, sa.getSymbol(domainNode, false))
+	}
+
+	matches := []*domain.SequenceMatch{}
+	for i := range querySymbols {
+		lb, rb := 0, len(sa.suffixArray)
+		length := 0
+		// 入力にないノードとは一致しないので、その手前までを一致とする
+		for ; i+length < len(querySymbols) && querySymbols[i+length] != noSymbol; length++ {
+			newLb, newRb := sa.narrow(lb, rb, length, querySymbols[i+length])
+			if newLb == newRb {
+				break
+			}
+			lb, rb = newLb, newRb
+		}
+
+		if length <= threshold {
+			continue
+		}
+
+		for _, leaf := range sa.suffixArray[lb:rb] {
+			if i > 0 && leaf > 0 && querySymbols[i-1] == sa.symbols[leaf-1] {
+				continue
+			}
+
+			matches = append(matches, domain.NewSequenceMatch(i, sa.newCloneSequence(int(leaf), length)))
+		}
+	}
+
+	return matches, nil
+}
+
+// narrow 先頭offset個の記号が一致する接尾辞の範囲[lb, rb)から、offset番目の記号がsymbolのものの範囲を返す
+func (sa *SuffixArray) narrow(lb, rb, offset int, symbol int32) (int, int) {
+	symbolAt := func(i int) int32 {
+		position := int(sa.suffixArray[i]) + offset
+		if position >= len(sa.symbols) {
+			return endSymbol
+		}
+
+		return sa.symbols[position]
+	}
+
+	newLb := lb + sort.Search(rb-lb, func(i int) bool {
+		return symbolAt(lb+i) >= symbol
+	})
+	newRb := newLb + sort.Search(rb-newLb, func(i int) bool {
+		return symbolAt(newLb+i) > symbol
+	})
+
+	return newLb, newRb
+}
+
+func (sa *SuffixArray) newCloneSequence(start int, length int) *domain.CloneSequence {
+	return domain.NewCloneSequence(sa.getDocument(start).id, start, sa.domainNodes[start:start+length])
+}
+
+func (sa *SuffixArray) isLeftDiverse(leafs []int) bool {
+	leftSymbol := noSymbol
+	for _, leaf := range leafs {
+		if leaf == 0 {
+			return true
+		}
+
+		if leftSymbol == noSymbol {
+			leftSymbol = sa.symbols[leaf-1]
+			continue
+		}
+
+		if leftSymbol != sa.symbols[leaf-1] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,342 @@
+package sarray_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/sarray"
+	"github.com/mazrean/go-clone-detection/serializer"
+	"github.com/mazrean/go-clone-detection/stree"
+)
+
+type suffixTree interface {
+	AddNode(node *domain.Node) error
+	CloseDocument() (int, error)
+	RemoveDocument(document int) error
+	GetClonePairs(threshold int) ([]*domain.CloneSequencePair, error)
+	EachClonePair(ctx context.Context, threshold int, yield func(*domain.CloneSequencePair) error) error
+	GetCloneClasses(threshold int) ([]*domain.CloneClass, error)
+	FindMatches(query []*domain.Node, threshold int) ([]*domain.SequenceMatch, error)
+}
+
+const duplicatedSource = `package p
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+
+func count(items []string) int {
+	n := 0
+	for _, item := range items {
+		if item != "" {
+			n += 1
+		}
+	}
+	return n
+}
+`
+
+// loadNodes テストの入力として、testdataのGoファイルと重複の多いファイルをノード列にする
+func loadNodes(t *testing.T) [][]*domain.Node {
+	t.Helper()
+
+	filenames, err := filepath.Glob("testdata/*.go")
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+	if len(filenames) == 0 {
+		t.Fatal("no test files found")
+	}
+
+	fset := token.NewFileSet()
+	documents := [][]*domain.Node{}
+	addFile := func(filename string, src interface{}) {
+		documents = append(documents, parseNodes(t, fset, filename, src))
+	}
+
+	addFile("dup1.go", duplicatedSource)
+	for _, filename := range filenames {
+		addFile(filename, nil)
+	}
+	addFile("dup2.go", duplicatedSource)
+
+	return documents
+}
+
+// parseNodes ファイルをパースしてノード列にする
+func parseNodes(t *testing.T, fset *token.FileSet, filename string, src interface{}) []*domain.Node {
+	t.Helper()
+
+	file, err := parser.ParseFile(fset, filename, src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse %s: %v", filename, err)
+	}
+
+	nodeChan := make(chan *domain.Node)
+	go func() {
+		defer close(nodeChan)
+		_ = serializer.NewSerializer(0).Serialize(context.Background(), file, nodeChan)
+	}()
+
+	nodes := []*domain.Node{}
+	for node := range nodeChan {
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+func build(t *testing.T, tree suffixTree, documents [][]*domain.Node) {
+	t.Helper()
+
+	for _, nodes := range documents {
+		for _, node := range nodes {
+			err := tree.AddNode(node)
+			if err != nil {
+				t.Fatalf("failed to add node: %v", err)
+			}
+		}
+
+		_, err := tree.CloseDocument()
+		if err != nil {
+			t.Fatalf("failed to close document: %v", err)
+		}
+	}
+}
+
+// sequenceKey ノードの位置に依存しない形でノード列を表す(どちらの実装も位置の順に並べるので、並べ替えずに比べる)
+func sequenceKey(sequence *domain.CloneSequence) string {
+	nodes := sequence.GetNodes()
+	return fmt.Sprintf("%d:%p:%d", sequence.GetDocument(), nodes[0], len(nodes))
+}
+
+func pairKey(clonePair *domain.CloneSequencePair) string {
+	sequence1, sequence2 := clonePair.GetSequences()
+	key1, key2 := sequenceKey(sequence1), sequenceKey(sequence2)
+	if key1 > key2 {
+		key1, key2 = key2, key1
+	}
+
+	return key1 + "-" + key2
+}
+
+func pairKeys(t *testing.T, tree suffixTree, threshold int) []string {
+	t.Helper()
+
+	clonePairs, err := tree.GetClonePairs(threshold)
+	if err != nil {
+		t.Fatalf("failed to get clone pairs: %v", err)
+	}
+
+	keys := make([]string, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		keys = append(keys, pairKey(clonePair))
+	}
+
+	return keys
+}
+
+func classKeys(t *testing.T, tree suffixTree, threshold int) []string {
+	t.Helper()
+
+	cloneClasses, err := tree.GetCloneClasses(threshold)
+	if err != nil {
+		t.Fatalf("failed to get clone classes: %v", err)
+	}
+
+	keys := make([]string, 0, len(cloneClasses))
+	for _, cloneClass := range cloneClasses {
+		sequenceKeys := []string{}
+		for _, sequence := range cloneClass.GetSequences() {
+			sequenceKeys = append(sequenceKeys, sequenceKey(sequence))
+		}
+		keys = append(keys, fmt.Sprint(sequenceKeys))
+	}
+
+	return keys
+}
+
+func matchKeys(t *testing.T, tree suffixTree, query []*domain.Node, threshold int) []string {
+	t.Helper()
+
+	matches, err := tree.FindMatches(query, threshold)
+	if err != nil {
+		t.Fatalf("failed to find matches: %v", err)
+	}
+
+	keys := make([]string, 0, len(matches))
+	for _, match := range matches {
+		keys = append(keys, fmt.Sprintf("%d-%s", match.GetQueryIndex(), sequenceKey(match.GetSequence())))
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+func TestSameAsSTree(t *testing.T) {
+	documents := loadNodes(t)
+
+	tests := []struct {
+		description string
+		threshold   int
+	}{
+		{
+			description: "small threshold",
+			threshold:   5,
+		},
+		{
+			description: "default threshold",
+			threshold:   10,
+		},
+		{
+			description: "large threshold",
+			threshold:   50,
+		},
+	}
+
+	sTree := stree.NewSTree()
+	build(t, sTree, documents)
+	suffixArray := sarray.NewSuffixArray()
+	build(t, suffixArray, documents)
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			expected := pairKeys(t, sTree, test.threshold)
+			if len(expected) == 0 {
+				t.Fatal("no clone pairs found by the suffix tree")
+			}
+
+			actual := pairKeys(t, suffixArray, test.threshold)
+			if !reflect.DeepEqual(expected, actual) {
+				t.Errorf("clone pairs differ: suffix tree %d, suffix array %d", len(expected), len(actual))
+			}
+
+			if !reflect.DeepEqual(classKeys(t, sTree, test.threshold), classKeys(t, suffixArray, test.threshold)) {
+				t.Error("clone classes differ")
+			}
+
+			query := documents[0]
+			if !reflect.DeepEqual(matchKeys(t, sTree, query, test.threshold), matchKeys(t, suffixArray, query, test.threshold)) {
+				t.Error("matches differ")
+			}
+		})
+	}
+}
+
+func TestFindMatchesUnknownNode(t *testing.T) {
+	documents := loadNodes(t)
+
+	sTree := stree.NewSTree()
+	build(t, sTree, documents)
+	suffixArray := sarray.NewSuffixArray()
+	build(t, suffixArray, documents)
+
+	// select文はどの入力にも含まれないので、その手前で一致が切れる
+	query := parseNodes(t, token.NewFileSet(), "query.go", `package p
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	select {}
+	return total
+}
+`)
+
+	expected := matchKeys(t, sTree, query, 5)
+	if len(expected) == 0 {
+		t.Fatal("no matches found by the suffix tree")
+	}
+
+	actual := matchKeys(t, suffixArray, query, 5)
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("matches differ: suffix tree %v, suffix array %v", expected, actual)
+	}
+}
+
+func TestRemoveDocument(t *testing.T) {
+	documents := loadNodes(t)
+
+	sTree := stree.NewSTree()
+	build(t, sTree, documents)
+	suffixArray := sarray.NewSuffixArray()
+	build(t, suffixArray, documents)
+
+	for _, document := range []int{0, 3} {
+		for _, tree := range []suffixTree{sTree, suffixArray} {
+			err := tree.RemoveDocument(document)
+			if err != nil {
+				t.Fatalf("failed to remove document: %v", err)
+			}
+		}
+
+		// 削除した入力のノードの位置が変わるので、ノード自体で比べる
+		if !reflect.DeepEqual(pairKeys(t, sTree, 5), pairKeys(t, suffixArray, 5)) {
+			t.Errorf("clone pairs differ after removing document %d", document)
+		}
+	}
+
+	err := suffixArray.RemoveDocument(0)
+	if err == nil {
+		t.Error("removing a removed document should fail")
+	}
+}
+
+func TestEachClonePair(t *testing.T) {
+	documents := loadNodes(t)
+	errStop := errors.New("stop")
+
+	sTree := stree.NewSTree()
+	build(t, sTree, documents)
+	suffixArray := sarray.NewSuffixArray()
+	build(t, suffixArray, documents)
+
+	for _, tree := range []suffixTree{sTree, suffixArray} {
+		expected := pairKeys(t, tree, 10)
+		sort.Strings(expected)
+
+		actual := []string{}
+		err := tree.EachClonePair(context.Background(), 10, func(clonePair *domain.CloneSequencePair) error {
+			actual = append(actual, pairKey(clonePair))
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("failed to iterate clone pairs: %v", err)
+		}
+		sort.Strings(actual)
+
+		if !reflect.DeepEqual(expected, actual) {
+			t.Errorf("%T: clone pairs differ from GetClonePairs: expected %d, actual %d", tree, len(expected), len(actual))
+		}
+
+		count := 0
+		err = tree.EachClonePair(context.Background(), 10, func(clonePair *domain.CloneSequencePair) error {
+			count++
+			return errStop
+		})
+		if !errors.Is(err, errStop) {
+			t.Errorf("%T: unexpected error: %v", tree, err)
+		}
+		if count != 1 {
+			t.Errorf("%T: yield was called %d times after returning an error", tree, count)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package clone
+
+import (
+	"go/ast"
+	"reflect"
+)
+
+// CloneType クローンの種類
+type CloneType int
+
+const (
+	// CloneTypeUnknown 比較に使うASTがなく分類できなかったクローン
+	CloneTypeUnknown CloneType = iota
+	// CloneType1 空白・コメント以外が完全に一致するクローン
+	CloneType1
+	// CloneType2 識別子・リテラル・代入などの演算子のみが異なるクローン
+	CloneType2
+	// CloneType3 文の追加・削除などの構造の違いを含むクローン
+	CloneType3
+)
+
+func (ct CloneType) String() string {
+	switch ct {
+	case CloneType1:
+		return "Type-1"
+	case CloneType2:
+		return "Type-2"
+	case CloneType3:
+		return "Type-3"
+	}
+
+	return "Unknown"
+}
+
+// classifyCloneType 2つのコード片のASTを比較してクローンの種類を判定する
+func classifyCloneType(nodes1, nodes2 []ast.Node) CloneType {
+	flatNodes1, ok := flattenNodes(nodes1)
+	if !ok {
+		return CloneTypeUnknown
+	}
+
+	flatNodes2, ok := flattenNodes(nodes2)
+	if !ok {
+		return CloneTypeUnknown
+	}
+
+	if len(flatNodes1) != len(flatNodes2) {
+		return CloneType3
+	}
+
+	cloneType := CloneType1
+	for i := range flatNodes1 {
+		if reflect.TypeOf(flatNodes1[i]) != reflect.TypeOf(flatNodes2[i]) {
+			return CloneType3
+		}
+
+		if !equalNodeAttributes(flatNodes1[i], flatNodes2[i]) {
+			cloneType = CloneType2
+		}
+	}
+
+	return cloneType
+}
+
+// flattenNodes コメントを除いたASTのノードを行きがけ順に並べる
+func flattenNodes(roots []ast.Node) ([]ast.Node, bool) {
+	nodes := []ast.Node{}
+	for _, root := range roots {
+		if root == nil {
+			return nil, false
+		}
+
+		ast.Inspect(root, func(node ast.Node) bool {
+			switch node.(type) {
+			case nil:
+				return false
+			case *ast.Comment, *ast.CommentGroup:
+				return false
+			}
+
+			nodes = append(nodes, node)
+
+			return true
+		})
+	}
+
+	return nodes, true
+}
+
+// equalNodeAttributes 子ノード以外の属性(識別子名、リテラルの値、演算子など)が一致するか
+func equalNodeAttributes(node1, node2 ast.Node) bool {
+	switch node1 := node1.(type) {
+	case *ast.Ident:
+		return node1.Name == node2.(*ast.Ident).Name
+	case *ast.BasicLit:
+		node2 := node2.(*ast.BasicLit)
+		return node1.Kind == node2.Kind && node1.Value == node2.Value
+	case *ast.AssignStmt:
+		return node1.Tok == node2.(*ast.AssignStmt).Tok
+	case *ast.RangeStmt:
+		return node1.Tok == node2.(*ast.RangeStmt).Tok
+	case *ast.BinaryExpr:
+		return node1.Op == node2.(*ast.BinaryExpr).Op
+	case *ast.UnaryExpr:
+		return node1.Op == node2.(*ast.UnaryExpr).Op
+	case *ast.IncDecStmt:
+		return node1.Tok == node2.(*ast.IncDecStmt).Tok
+	case *ast.BranchStmt:
+		return node1.Tok == node2.(*ast.BranchStmt).Tok
+	case *ast.GenDecl:
+		return node1.Tok == node2.(*ast.GenDecl).Tok
+	case *ast.ChanType:
+		return node1.Dir == node2.(*ast.ChanType).Dir
+	}
+
+	return true
+}
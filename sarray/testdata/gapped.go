@@ -0,0 +1,176 @@
+package clone
+
+import (
+	"sort"
+
+	"github.com/mazrean/go-clone-detection/domain"
+)
+
+// gappedClone ギャップを挟んで並ぶ完全一致のクローンを結合したもの
+type gappedClone struct {
+	// 2つのコード片それぞれの、ソースコード上の順に並んだ一致部分
+	segments1 []*domain.CloneSequence
+	segments2 []*domain.CloneSequence
+}
+
+func (gc *gappedClone) end1() int {
+	last := gc.segments1[len(gc.segments1)-1]
+	return last.GetIndex() + last.GetLength()
+}
+
+func (gc *gappedClone) end2() int {
+	last := gc.segments2[len(gc.segments2)-1]
+	return last.GetIndex() + last.GetLength()
+}
+
+// span 各コード片の先頭の一致部分から末尾の一致部分までのノード数
+func (gc *gappedClone) span() (int, int) {
+	return gc.end1() - gc.segments1[0].GetIndex(), gc.end2() - gc.segments2[0].GetIndex()
+}
+
+func (gc *gappedClone) matchedLength() int {
+	length := 0
+	for _, segment := range gc.segments1 {
+		length += segment.GetLength()
+	}
+
+	return length
+}
+
+/*
+mergeGappedClones 両方のコード片でmaxGap以下の間隔で続く完全一致のクローンを結合し、
+2つ以上の一致部分からなるものを返す
+*/
+func mergeGappedClones(cloneSequencePairs []*domain.CloneSequencePair, maxGap int) []*gappedClone {
+	type documentPair struct {
+		document1, document2 int
+	}
+
+	// 入力の組ごとに、前にある方を1つ目にそろえて分ける
+	pairsMap := map[documentPair][][2]*domain.CloneSequence{}
+	for _, cloneSequencePair := range cloneSequencePairs {
+		sequence1, sequence2 := cloneSequencePair.GetSequences()
+		if sequence1.GetIndex() > sequence2.GetIndex() {
+			sequence1, sequence2 = sequence2, sequence1
+		}
+
+		key := documentPair{sequence1.GetDocument(), sequence2.GetDocument()}
+		pairsMap[key] = append(pairsMap[key], [2]*domain.CloneSequence{sequence1, sequence2})
+	}
+
+	gappedClones := []*gappedClone{}
+	for key, pairs := range pairsMap {
+		sort.Slice(pairs, func(i, j int) bool {
+			if pairs[i][0].GetIndex() == pairs[j][0].GetIndex() {
+				return pairs[i][1].GetIndex() < pairs[j][1].GetIndex()
+			}
+
+			return pairs[i][0].GetIndex() < pairs[j][0].GetIndex()
+		})
+
+		// まだ後ろに一致部分を繋げられる可能性のあるもの
+		openClones := []*gappedClone{}
+		for _, pair := range pairs {
+			start1, start2 := pair[0].GetIndex(), pair[1].GetIndex()
+
+			var merged bool
+			nextOpenClones := openClones[:0]
+			for _, gc := range openClones {
+				if start1-gc.end1() > maxGap {
+					// 1つ目の開始位置の順に見ているので、これ以降繋がることはない
+					if len(gc.segments1) > 1 {
+						gappedClones = append(gappedClones, gc)
+					}
+					continue
+				}
+				nextOpenClones = append(nextOpenClones, gc)
+
+				if merged {
+					continue
+				}
+
+				/*
+					極大なクローン同士は重なることがあるので、重なった分は後ろのクローンの先頭を削る
+					両方のコード片で同じだけ削らないと対応がずれる
+				*/
+				overlap := 0
+				if gc.end1()-start1 > overlap {
+					overlap = gc.end1() - start1
+				}
+				if gc.end2()-start2 > overlap {
+					overlap = gc.end2() - start2
+				}
+				if overlap >= pair[0].GetLength() {
+					continue
+				}
+
+				gap1, gap2 := start1+overlap-gc.end1(), start2+overlap-gc.end2()
+				if gap1 > maxGap || gap2 > maxGap {
+					continue
+				}
+
+				// 同じ入力内のクローンでは2つのコード片が重ならないようにする
+				if key.document1 == key.document2 && pair[0].GetIndex()+pair[0].GetLength() > gc.segments2[0].GetIndex() {
+					continue
+				}
+
+				gc.segments1 = append(gc.segments1, trimSequence(pair[0], overlap))
+				gc.segments2 = append(gc.segments2, trimSequence(pair[1], overlap))
+				merged = true
+			}
+			openClones = nextOpenClones
+
+			if !merged {
+				openClones = append(openClones, &gappedClone{
+					segments1: []*domain.CloneSequence{pair[0]},
+					segments2: []*domain.CloneSequence{pair[1]},
+				})
+			}
+		}
+
+		for _, gc := range openClones {
+			if len(gc.segments1) > 1 {
+				gappedClones = append(gappedClones, gc)
+			}
+		}
+	}
+
+	return gappedClones
+}
+
+// trimSequence ノード列の先頭からlengthだけ取り除く
+func trimSequence(sequence *domain.CloneSequence, length int) *domain.CloneSequence {
+	if length == 0 {
+		return sequence
+	}
+
+	return domain.NewCloneSequence(
+		sequence.GetDocument(),
+		sequence.GetIndex()+length,
+		sequence.GetNodes()[length:],
+	)
+}
+
+func (cd *CloneDetector) newGappedClonePair(gc *gappedClone) *ClonePair {
+	roots1, roots2 := []*domain.Node{}, []*domain.Node{}
+	matchedNodes := []*domain.Node{}
+	for i := range gc.segments1 {
+		nodes1, nodes2 := gc.segments1[i].GetNodes(), gc.segments2[i].GetNodes()
+		for _, j := range splitSubtrees(nodes1, -1) {
+			roots1 = append(roots1, nodes1[j])
+			roots2 = append(roots2, nodes2[j])
+		}
+
+		matchedNodes = append(matchedNodes, nodes1...)
+	}
+
+	span1, span2 := gc.span()
+
+	return &ClonePair{
+		Fragment1:   newSequenceFragment(cd.fset, roots1, span1),
+		Fragment2:   newSequenceFragment(cd.fset, roots2, span2),
+		Fingerprint: fingerprint(matchedNodes),
+		Type:        CloneType3,
+		Similarity:  float64(2*gc.matchedLength()) / float64(span1+span2),
+	}
+}
@@ -0,0 +1,86 @@
+package clone
+
+import "go/ast"
+
+// identifierPair 構造が一致する2つのコード片で、対応する位置にある識別子
+type identifierPair struct {
+	ident1 *ast.Ident
+	ident2 *ast.Ident
+}
+
+// alignIdentifiers 構造が一致する2つのコード片の識別子を出現順に対応付ける
+func alignIdentifiers(nodes1, nodes2 []ast.Node) ([]*identifierPair, bool) {
+	idents1, ok := collectIdentifiers(nodes1)
+	if !ok {
+		return nil, false
+	}
+
+	idents2, ok := collectIdentifiers(nodes2)
+	if !ok {
+		return nil, false
+	}
+
+	if len(idents1) != len(idents2) {
+		return nil, false
+	}
+
+	identPairs := make([]*identifierPair, 0, len(idents1))
+	for i := range idents1 {
+		identPairs = append(identPairs, &identifierPair{
+			ident1: idents1[i],
+			ident2: idents2[i],
+		})
+	}
+
+	return identPairs, true
+}
+
+func collectIdentifiers(roots []ast.Node) ([]*ast.Ident, bool) {
+	idents := []*ast.Ident{}
+	for _, root := range roots {
+		if root == nil {
+			return nil, false
+		}
+
+		ast.Inspect(root, func(node ast.Node) bool {
+			if ident, ok := node.(*ast.Ident); ok {
+				idents = append(idents, ident)
+			}
+
+			return true
+		})
+	}
+
+	return idents, true
+}
+
+/*
+isParameterizedMatch 2つのコード片の識別子の間に一対一の対応があるか
+(Bakerのparameterized match)
+x := a + b; return x と y := c + d; return c のように、
+データの流れが異なるものは対応が一対一にならない
+*/
+func isParameterizedMatch(nodes1, nodes2 []ast.Node) bool {
+	identPairs, ok := alignIdentifiers(nodes1, nodes2)
+	if !ok {
+		return false
+	}
+
+	forward := map[string]string{}
+	backward := map[string]string{}
+	for _, identPair := range identPairs {
+		name1, name2 := identPair.ident1.Name, identPair.ident2.Name
+
+		if mapped, ok := forward[name1]; ok && mapped != name2 {
+			return false
+		}
+		if mapped, ok := backward[name2]; ok && mapped != name1 {
+			return false
+		}
+
+		forward[name1] = name2
+		backward[name2] = name1
+	}
+
+	return true
+}
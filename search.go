@@ -0,0 +1,78 @@
+package clone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+
+	"github.com/mazrean/go-clone-detection/domain"
+)
+
+/*
+FindSimilar 追加済みのファイルから、nodeの部分木のうちminLen個以上のASTノードからなるものと一致するコード片を探す
+結果のClonePairの1つ目はnode内の部分木、2つ目は見つかったコード片になる
+位置情報の解決に使うので、nodeはFileSetでパースしたASTである必要がある
+*/
+func (cd *CloneDetector) FindSimilar(ctx context.Context, node ast.Node, minLen int) ([]*ClonePair, error) {
+	if node == nil {
+		return nil, errors.New("node is nil")
+	}
+
+	if minLen < 1 {
+		return nil, errors.New("minLen must be positive")
+	}
+
+	query, err := cd.serialize(ctx, node)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := cd.suffixTree.FindMatches(query, minLen-1)
+	if err != nil {
+		return nil, fmt.Errorf("suffix tree error: %w", err)
+	}
+
+	type rootPair struct {
+		queryRoot, root *domain.Node
+	}
+	found := map[rootPair]struct{}{}
+
+	clonePairs := []*ClonePair{}
+	for _, match := range matches {
+		queryNodes := query[match.GetQueryIndex() : match.GetQueryIndex()+match.GetLength()]
+		nodes := match.GetSequence().GetNodes()
+		for _, i := range splitSubtrees(queryNodes, minLen-2, cd.areUnits([][]*domain.Node{queryNodes, nodes})) {
+			// 検索したコード自体が追加済みの場合は除く
+			if queryNodes[i].GetNode() == nodes[i].GetNode() {
+				continue
+			}
+
+			key := rootPair{queryNodes[i], nodes[i]}
+			if _, ok := found[key]; ok {
+				continue
+			}
+			found[key] = struct{}{}
+
+			node1, node2 := queryNodes[i].GetNode(), nodes[i].GetNode()
+			if cd.config.ParameterizedMatch && !isParameterizedMatch([]ast.Node{node1}, []ast.Node{node2}) {
+				continue
+			}
+
+			clonePairs = append(clonePairs, &ClonePair{
+				Node1:       node1,
+				Node2:       node2,
+				Fragment1:   newFragment(cd.fset, queryNodes[i]),
+				Fragment2:   newFragment(cd.fset, nodes[i]),
+				Fingerprint: fingerprint(subtree(queryNodes, i)),
+				Type:        classifyCloneType([]ast.Node{node1}, []ast.Node{node2}),
+				Similarity:  1,
+			})
+		}
+	}
+
+	// 1つ目は検索したコードにそろえたままにするので、向きはそろえずに並べる
+	sortClonePairs(clonePairs)
+
+	return clonePairs, nil
+}
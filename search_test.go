@@ -0,0 +1,114 @@
+package clone_test
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"reflect"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+const querySource = `package q
+
+func positiveTotal(xs []int) int {
+	s := 0
+	for _, x := range xs {
+		if x > 0 {
+			s += x
+		}
+	}
+	return s
+}
+
+func half(x int) int {
+	return x / 2
+}
+`
+
+func findSimilar(t *testing.T, cd *clone.CloneDetector, src string, minLen int) []*clone.ClonePair {
+	t.Helper()
+
+	file, err := parser.ParseFile(cd.FileSet(), "query.go", src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse query: %v", err)
+	}
+
+	clonePairs, err := cd.FindSimilar(context.Background(), file, minLen)
+	if err != nil {
+		t.Fatalf("failed to find similar code: %v", err)
+	}
+
+	return clonePairs
+}
+
+func TestFindSimilar(t *testing.T) {
+	cd := newSourceDetector(t, clone.Config{}, source{"a.go", sumSource}, source{"b.go", joinSource})
+
+	tests := []struct {
+		description string
+		minLen      int
+		expected    []string
+	}{
+		{
+			description: "whole function",
+			minLen:      10,
+			expected:    []string{"query.go:3:1-11:2 a.go:3:1-11:2 30"},
+		},
+		{
+			description: "minLen equal to the function",
+			minLen:      30,
+			expected:    []string{"query.go:3:1-11:2 a.go:3:1-11:2 30"},
+		},
+		{
+			description: "minLen longer than the function",
+			minLen:      31,
+			expected:    []string{},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			actual := similarStrings(findSimilar(t, cd, querySource, test.minLen))
+			if !reflect.DeepEqual(test.expected, actual) {
+				t.Errorf("unexpected results:\nexpected %v\nactual   %v", test.expected, actual)
+			}
+		})
+	}
+}
+
+func TestFindSimilarRemovedFile(t *testing.T) {
+	cd := newSourceDetector(t, clone.Config{}, source{"a.go", sumSource}, source{"b.go", joinSource}, source{"c.go", sumSource})
+
+	expected := []string{
+		"query.go:3:1-11:2 a.go:3:1-11:2 30",
+		"query.go:3:1-11:2 c.go:3:1-11:2 30",
+	}
+	actual := similarStrings(findSimilar(t, cd, querySource, 10))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Fatalf("unexpected results:\nexpected %v\nactual   %v", expected, actual)
+	}
+
+	err := cd.RemoveFile("a.go")
+	if err != nil {
+		t.Fatalf("failed to remove file: %v", err)
+	}
+
+	// 削除したファイルのleafは、残ったファイルと同じ部分木にあっても返さない
+	expected = []string{"query.go:3:1-11:2 c.go:3:1-11:2 30"}
+	actual = similarStrings(findSimilar(t, cd, querySource, 10))
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("unexpected results after removing a.go:\nexpected %v\nactual   %v", expected, actual)
+	}
+}
+
+func similarStrings(clonePairs []*clone.ClonePair) []string {
+	lines := make([]string, 0, len(clonePairs))
+	for _, clonePair := range clonePairs {
+		lines = append(lines, fmt.Sprintf("%s %s %d", clonePair.Fragment1, clonePair.Fragment2, clonePair.Fragment1.TokenCount))
+	}
+
+	return lines
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/mazrean/go-clone-detection/domain"
 )
 
+// Serializer AddFiles・AddNodesでは複数のASTについて並行に呼び出される
 type Serializer interface {
 	Serialize(ctx context.Context, root ast.Node, nodeChan chan<- *domain.Node) error
 }
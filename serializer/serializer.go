@@ -5,21 +5,42 @@ import (
 	"errors"
 	"go/ast"
 	"go/token"
+	"hash/fnv"
 	"log"
 
 	"github.com/mazrean/go-clone-detection/domain"
 	"github.com/mazrean/go-clone-detection/domain/values"
 )
 
+// Mode 比較するノードに含める情報
+type Mode uint8
+
+const (
+	// ModeIdentifier 識別子名を区別する
+	ModeIdentifier Mode = 1 << iota
+	// ModeLiteral リテラルの値を区別する
+	ModeLiteral
+)
+
+/*
+Serializer ASTを帰りがけ順のノード列に変換する
+ゼロ値は識別子名・リテラルの値を区別しない
+状態を持たないので、Serializeは並行に呼び出せる
+*/
 type Serializer struct {
-	nodes []*domain.Node
+	mode Mode
 }
 
-func (s *Serializer) Serialize(ctx context.Context, root ast.Node, nodeChan chan<- *domain.Node) error {
-	s.nodes = []*domain.Node{}
+func NewSerializer(mode Mode) *Serializer {
+	return &Serializer{
+		mode: mode,
+	}
+}
 
+func (s *Serializer) Serialize(ctx context.Context, root ast.Node, nodeChan chan<- *domain.Node) error {
 	visitor := &visitor{
 		ctx:      ctx,
+		mode:     s.mode,
 		nodeChan: nodeChan,
 		stack:    []*stackValue{},
 	}
@@ -36,6 +57,7 @@ type stackValue struct {
 
 type visitor struct {
 	ctx      context.Context
+	mode     Mode
 	nodeChan chan<- *domain.Node
 	stack    []*stackValue
 }
@@ -82,6 +104,7 @@ func (v *visitor) Visit(node ast.Node) ast.Visitor {
 				values.NewPosition(int64(node.Pos()), int64(node.End())),
 				0,
 				getNodeToken(node),
+				getNodeValue(node, v.mode),
 			),
 			childCounter: childCounter,
 		}
@@ -160,6 +183,8 @@ func getNodeType(node ast.Node) (values.NodeType, error) {
 		return values.NodeTypeIncDecStmt, nil
 	case *ast.IndexExpr:
 		return values.NodeTypeIndexExpr, nil
+	case *ast.IndexListExpr:
+		return values.NodeTypeIndexListExpr, nil
 	case *ast.InterfaceType:
 		return values.NodeTypeInterfaceType, nil
 	case *ast.KeyValueExpr:
@@ -168,6 +193,8 @@ func getNodeType(node ast.Node) (values.NodeType, error) {
 		return values.NodeTypeLabeledStmt, nil
 	case *ast.MapType:
 		return values.NodeTypeMapType, nil
+	case *ast.Package:
+		return values.NodeTypePackage, nil
 	case *ast.ParenExpr:
 		return values.NodeTypeParenExpr, nil
 	case *ast.RangeStmt:
@@ -203,6 +230,35 @@ func getNodeType(node ast.Node) (values.NodeType, error) {
 	return 0, errors.New("unknown node type")
 }
 
+// getNodeValue modeで区別する識別子名・リテラルの値のハッシュ
+func getNodeValue(node ast.Node, mode Mode) values.NodeValue {
+	switch node := node.(type) {
+	case *ast.Ident:
+		if mode&ModeIdentifier != 0 {
+			return hashValue(node.Name)
+		}
+	case *ast.BasicLit:
+		if mode&ModeLiteral != 0 {
+			return hashValue(node.Value)
+		}
+	}
+
+	return values.NodeValueNone
+}
+
+func hashValue(value string) values.NodeValue {
+	hash := fnv.New64a()
+	hash.Write([]byte(value))
+
+	nodeValue := values.NodeValue(hash.Sum64())
+	if nodeValue == values.NodeValueNone {
+		// 値を比較しないノードと区別できるようにする
+		nodeValue++
+	}
+
+	return nodeValue
+}
+
 func getNodeToken(node ast.Node) values.NodeToken {
 	switch node := node.(type) {
 	case *ast.AssignStmt:
@@ -343,8 +399,14 @@ func getNodeToken(node ast.Node) values.NodeToken {
 			return values.NodeTokenNot
 		case token.ARROW:
 			return values.NodeTokenArrow
+		case token.ADD:
+			return values.NodeTokenAdd
 		case token.SUB:
 			return values.NodeTokenSub
+		case token.XOR:
+			return values.NodeTokenXor
+		case token.TILDE:
+			return values.NodeTokenTilde
 		}
 
 		log.Printf("unknown unary token: %v", node.Op)
@@ -0,0 +1,293 @@
+package serializer_test
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+	"github.com/mazrean/go-clone-detection/serializer"
+)
+
+const genericSource = `package p
+
+type Number interface {
+	~int | ~int64 | float64
+}
+
+type Pair[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+func Sum[T Number](values []T) T {
+	var total T
+	for _, value := range values {
+		total += value
+	}
+	return total
+}
+
+func Keys[K comparable, V any](pairs []Pair[K, V]) []K {
+	keys := make([]K, 0, len(pairs))
+	for _, pair := range pairs {
+		keys = append(keys, pair.Key)
+	}
+	return keys
+}
+
+var total = Sum[int]([]int{1, 2})
+var keys = Keys[string, int](nil)
+`
+
+func serialize(t *testing.T, root ast.Node) []*domain.Node {
+	t.Helper()
+
+	return serializeMode(t, root, 0)
+}
+
+func serializeMode(t *testing.T, root ast.Node, mode serializer.Mode) []*domain.Node {
+	t.Helper()
+
+	nodeChan := make(chan *domain.Node)
+	go func() {
+		defer close(nodeChan)
+		_ = serializer.NewSerializer(mode).Serialize(context.Background(), root, nodeChan)
+	}()
+
+	nodes := []*domain.Node{}
+	for node := range nodeChan {
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+func TestSerializeGenerics(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "generic.go", genericSource, 0)
+	if err != nil {
+		t.Fatalf("failed to parse source: %v", err)
+	}
+
+	nodes := serialize(t, file)
+
+	// 未知のノードがあると部分木ごと落ちるので、ASTの全ノードが変換されていることを確かめる
+	astNodes := []ast.Node{}
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n != nil {
+			astNodes = append(astNodes, n)
+		}
+		return true
+	})
+	if len(nodes) != len(astNodes) {
+		t.Fatalf("number of nodes differs: expected %d, actual %d", len(astNodes), len(nodes))
+	}
+
+	var indexListExprs, tildes, unions, typeParamFields int
+	for _, node := range nodes {
+		switch astNode := node.GetNode().(type) {
+		case *ast.IndexListExpr:
+			indexListExprs++
+			if node.GetNodeType() != values.NodeTypeIndexListExpr {
+				t.Errorf("unexpected node type of index list expression: %v", node.GetNodeType())
+			}
+		case *ast.UnaryExpr:
+			if astNode.Op == token.TILDE {
+				tildes++
+				if node.GetToken() != values.NodeTokenTilde {
+					t.Errorf("unexpected token of ~: %v", node.GetToken())
+				}
+			}
+		case *ast.BinaryExpr:
+			if astNode.Op == token.OR {
+				unions++
+				if node.GetToken() != values.NodeTokenOr {
+					t.Errorf("unexpected token of union: %v", node.GetToken())
+				}
+			}
+		}
+	}
+
+	// 型パラメータリストは型パラメータの宣言ごとのFieldを子に持つFieldListになる
+	serialized := map[ast.Node]*domain.Node{}
+	for _, node := range nodes {
+		serialized[node.GetNode()] = node
+	}
+	ast.Inspect(file, func(n ast.Node) bool {
+		var typeParams *ast.FieldList
+		switch n := n.(type) {
+		case *ast.FuncType:
+			typeParams = n.TypeParams
+		case *ast.TypeSpec:
+			typeParams = n.TypeParams
+		}
+		if typeParams == nil {
+			return true
+		}
+
+		node, ok := serialized[typeParams]
+		if !ok || node.GetNodeType() != values.NodeTypeFieldList {
+			t.Errorf("type parameter list is not serialized as a field list")
+			return true
+		}
+		for _, field := range typeParams.List {
+			if _, ok := serialized[field]; ok {
+				typeParamFields++
+			}
+		}
+
+		return true
+	})
+
+	if indexListExprs != 2 {
+		t.Errorf("unexpected number of index list expressions: expected 2, actual %d", indexListExprs)
+	}
+	if tildes != 2 {
+		t.Errorf("unexpected number of ~ terms: expected 2, actual %d", tildes)
+	}
+	if unions != 2 {
+		t.Errorf("unexpected number of unions: expected 2, actual %d", unions)
+	}
+	if typeParamFields != 5 {
+		t.Errorf("unexpected number of type parameters: expected 5, actual %d", typeParamFields)
+	}
+}
+
+func TestSerializeTypeParamsDistinct(t *testing.T) {
+	parse := func(src string) []*domain.Node {
+		file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+		if err != nil {
+			t.Fatalf("failed to parse source: %v", err)
+		}
+
+		return serialize(t, file)
+	}
+
+	// 型パラメータの有無や制約の~の有無は区別する
+	cases := []struct {
+		name       string
+		src1, src2 string
+	}{
+		{
+			name: "type params",
+			src1: "package p\nfunc f[T any](v T) T { return v }\n",
+			src2: "package p\nfunc f(v T) T { return v }\n",
+		},
+		{
+			name: "tilde",
+			src1: "package p\ntype C interface{ ~int | string }\n",
+			src2: "package p\ntype C interface{ int | string }\n",
+		},
+		{
+			name: "index list",
+			src1: "package p\nvar v = f[int, string]\n",
+			src2: "package p\nvar v = f[int]\n",
+		},
+	}
+
+	for _, c := range cases {
+		c := c
+		t.Run(c.name, func(t *testing.T) {
+			nodes1, nodes2 := parse(c.src1), parse(c.src2)
+			if len(nodes1) == len(nodes2) {
+				same := true
+				for i := range nodes1 {
+					if nodes1[i].GetNodeType() != nodes2[i].GetNodeType() || nodes1[i].GetToken() != nodes2[i].GetToken() {
+						same = false
+						break
+					}
+				}
+				if same {
+					t.Error("different sources are serialized into the same nodes")
+				}
+			}
+		})
+	}
+}
+
+func TestSerializeMode(t *testing.T) {
+	tests := []struct {
+		description string
+		mode        serializer.Mode
+		expr        string
+		same        bool
+	}{
+		{
+			description: "default mode ignores identifiers",
+			mode:        0,
+			expr:        "y + 1",
+			same:        true,
+		},
+		{
+			description: "default mode ignores literals",
+			mode:        0,
+			expr:        "x + 2",
+			same:        true,
+		},
+		{
+			description: "identifier mode separates identifiers",
+			mode:        serializer.ModeIdentifier,
+			expr:        "y + 1",
+			same:        false,
+		},
+		{
+			description: "identifier mode ignores literals",
+			mode:        serializer.ModeIdentifier,
+			expr:        "x + 2",
+			same:        true,
+		},
+		{
+			description: "literal mode separates literals",
+			mode:        serializer.ModeLiteral,
+			expr:        "x + 2",
+			same:        false,
+		},
+		{
+			description: "literal mode ignores identifiers",
+			mode:        serializer.ModeLiteral,
+			expr:        "y + 1",
+			same:        true,
+		},
+		{
+			description: "both modes",
+			mode:        serializer.ModeIdentifier | serializer.ModeLiteral,
+			expr:        "x + 1",
+			same:        true,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			expr1, err := parser.ParseExpr("x + 1")
+			if err != nil {
+				t.Fatalf("failed to parse expression: %v", err)
+			}
+			expr2, err := parser.ParseExpr(test.expr)
+			if err != nil {
+				t.Fatalf("failed to parse expression: %v", err)
+			}
+
+			nodes1, nodes2 := serializeMode(t, expr1, test.mode), serializeMode(t, expr2, test.mode)
+			if len(nodes1) != len(nodes2) {
+				t.Fatalf("number of nodes differs: %d, %d", len(nodes1), len(nodes2))
+			}
+
+			same := true
+			for i := range nodes1 {
+				if nodes1[i].GetNodeType() != nodes2[i].GetNodeType() ||
+					nodes1[i].GetToken() != nodes2[i].GetToken() ||
+					nodes1[i].GetValue() != nodes2[i].GetValue() ||
+					nodes1[i].GetChildCount() != nodes2[i].GetChildCount() {
+					same = false
+				}
+			}
+			if same != test.same {
+				t.Errorf("x + 1 and %s: expected same %t, actual %t", test.expr, test.same, same)
+			}
+		})
+	}
+}
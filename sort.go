@@ -0,0 +1,60 @@
+package clone
+
+import "sort"
+
+// compareFragments ファイル名、開始位置、終了位置の順に比較する
+func compareFragments(fragment1, fragment2 *Fragment) int {
+	switch {
+	case fragment1.Filename != fragment2.Filename:
+		if fragment1.Filename < fragment2.Filename {
+			return -1
+		}
+		return 1
+	case fragment1.StartLine != fragment2.StartLine:
+		return fragment1.StartLine - fragment2.StartLine
+	case fragment1.StartColumn != fragment2.StartColumn:
+		return fragment1.StartColumn - fragment2.StartColumn
+	case fragment1.EndLine != fragment2.EndLine:
+		return fragment1.EndLine - fragment2.EndLine
+	}
+
+	return fragment1.EndColumn - fragment2.EndColumn
+}
+
+// orient 前にあるコード片が1つ目になるようにそろえる
+func (cp *ClonePair) orient() {
+	if compareFragments(cp.Fragment1, cp.Fragment2) > 0 {
+		cp.Node1, cp.Node2 = cp.Node2, cp.Node1
+		cp.Fragment1, cp.Fragment2 = cp.Fragment2, cp.Fragment1
+	}
+}
+
+// sortClonePairs 1つ目のコード片、2つ目のコード片、ノード数の順に並べる
+func sortClonePairs(clonePairs []*ClonePair) {
+	sort.SliceStable(clonePairs, func(i, j int) bool {
+		clonePair1, clonePair2 := clonePairs[i], clonePairs[j]
+		if c := compareFragments(clonePair1.Fragment1, clonePair2.Fragment1); c != 0 {
+			return c < 0
+		}
+		if c := compareFragments(clonePair1.Fragment2, clonePair2.Fragment2); c != 0 {
+			return c < 0
+		}
+
+		return clonePair1.Fragment1.TokenCount < clonePair2.Fragment1.TokenCount
+	})
+}
+
+// sortCloneClasses 先頭のコード片、ノード数、コード片の数の順に並べる
+func sortCloneClasses(cloneClasses []*CloneClass) {
+	sort.SliceStable(cloneClasses, func(i, j int) bool {
+		cloneClass1, cloneClass2 := cloneClasses[i], cloneClasses[j]
+		if c := compareFragments(cloneClass1.Fragments[0], cloneClass2.Fragments[0]); c != 0 {
+			return c < 0
+		}
+		if cloneClass1.TokenCount != cloneClass2.TokenCount {
+			return cloneClass1.TokenCount < cloneClass2.TokenCount
+		}
+
+		return len(cloneClass1.Fragments) < len(cloneClass2.Fragments)
+	})
+}
@@ -0,0 +1,150 @@
+package clone_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+const repeatCount = 5
+
+func newDetector(t *testing.T, e engine, concurrency int) *clone.CloneDetector {
+	t.Helper()
+
+	filenames, err := filepath.Glob("testdata/src/*.go")
+	if err != nil {
+		t.Fatalf("failed to list files: %v", err)
+	}
+
+	cd := clone.NewCloneDetector(&clone.Config{
+		Concurrency: concurrency,
+		Threshold:   10,
+		MaxGap:      10,
+		SuffixTree:  e.newSuffixTree(),
+	})
+
+	err = cd.AddFiles(context.Background(), filenames)
+	if err != nil {
+		t.Fatalf("failed to add files: %v", err)
+	}
+
+	return cd
+}
+
+func assertSameLines(t *testing.T, expected, actual []string) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Fatalf("number of results differs: expected %d, actual %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("result %d differs:\nexpected %s\nactual   %s", i, expected[i], actual[i])
+		}
+	}
+}
+
+func fragmentLess(fragment1, fragment2 *clone.Fragment) bool {
+	if fragment1.Filename != fragment2.Filename {
+		return fragment1.Filename < fragment2.Filename
+	}
+	if fragment1.StartLine != fragment2.StartLine {
+		return fragment1.StartLine < fragment2.StartLine
+	}
+
+	return fragment1.StartColumn < fragment2.StartColumn
+}
+
+func TestGetClonesDeterministic(t *testing.T) {
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			var expected []string
+			for i := 0; i < repeatCount; i++ {
+				// 並行に追加してもFileSetへの追加順以外は変わらない
+				clonePairs, err := newDetector(t, e, i+1).GetClones()
+				if err != nil {
+					t.Fatalf("failed to get clones: %v", err)
+				}
+
+				if i == 0 {
+					if len(clonePairs) == 0 {
+						t.Fatal("no clones found")
+					}
+
+					for j, clonePair := range clonePairs {
+						if fragmentLess(clonePair.Fragment2, clonePair.Fragment1) {
+							t.Errorf("fragments of clone %d are not ordered: %s %s", j, clonePair.Fragment1, clonePair.Fragment2)
+						}
+
+						if j > 0 && fragmentLess(clonePair.Fragment1, clonePairs[j-1].Fragment1) {
+							t.Errorf("clone %d is not sorted: %s after %s", j, clonePair.Fragment1, clonePairs[j-1].Fragment1)
+						}
+					}
+
+					expected = clonePairStrings(clonePairs)
+					continue
+				}
+
+				assertSameLines(t, expected, clonePairStrings(clonePairs))
+			}
+		})
+	}
+}
+
+func TestGetCloneClassesDeterministic(t *testing.T) {
+	for _, e := range engines {
+		e := e
+		t.Run(e.name, func(t *testing.T) {
+			var expected []string
+			for i := 0; i < repeatCount; i++ {
+				cloneClasses, err := newDetector(t, e, i+1).GetCloneClasses()
+				if err != nil {
+					t.Fatalf("failed to get clone classes: %v", err)
+				}
+
+				if i == 0 {
+					if len(cloneClasses) == 0 {
+						t.Fatal("no clone classes found")
+					}
+
+					for j, cloneClass := range cloneClasses {
+						for k := 1; k < len(cloneClass.Fragments); k++ {
+							if fragmentLess(cloneClass.Fragments[k], cloneClass.Fragments[k-1]) {
+								t.Errorf("fragments of clone class %d are not sorted", j)
+							}
+						}
+
+						if j > 0 && fragmentLess(cloneClass.Fragments[0], cloneClasses[j-1].Fragments[0]) {
+							t.Errorf("clone class %d is not sorted", j)
+						}
+					}
+
+					expected = cloneClassStrings(cloneClasses)
+					continue
+				}
+
+				assertSameLines(t, expected, cloneClassStrings(cloneClasses))
+			}
+		})
+	}
+}
+
+func TestEnginesSameOrder(t *testing.T) {
+	expected, err := newDetector(t, engines[0], 1).GetClones()
+	if err != nil {
+		t.Fatalf("failed to get clones: %v", err)
+	}
+
+	for _, e := range engines[1:] {
+		actual, err := newDetector(t, e, 1).GetClones()
+		if err != nil {
+			t.Fatalf("failed to get clones: %v", err)
+		}
+
+		assertSameLines(t, clonePairStrings(expected), clonePairStrings(actual))
+	}
+}
@@ -0,0 +1,144 @@
+package clone
+
+import (
+	"go/ast"
+
+	"github.com/mazrean/go-clone-detection/domain"
+)
+
+// statementPosition 文が属する文の並び(ブロック文・case節・select節の本体)と、その中での位置
+type statementPosition struct {
+	parent ast.Node
+	index  int
+}
+
+// statementPositions 追加したファイル中の文の位置を、ファイルごとに必要になった時点で求めて保持する
+type statementPositions struct {
+	cd        *CloneDetector
+	files     map[*ast.File]struct{}
+	positions map[ast.Node]statementPosition
+}
+
+func (cd *CloneDetector) newStatementPositions() *statementPositions {
+	return &statementPositions{
+		cd:        cd,
+		files:     map[*ast.File]struct{}{},
+		positions: map[ast.Node]statementPosition{},
+	}
+}
+
+// get nodeが文の並びに含まれる文の場合はその位置を返す(ファイル全体を追加していない場合はfalse)
+func (sp *statementPositions) get(node ast.Node) (statementPosition, bool) {
+	if node == nil {
+		return statementPosition{}, false
+	}
+
+	file, ok := sp.cd.astFiles[sp.cd.fset.File(node.Pos())]
+	if !ok {
+		return statementPosition{}, false
+	}
+
+	if _, ok := sp.files[file]; !ok {
+		sp.files[file] = struct{}{}
+
+		ast.Inspect(file, func(n ast.Node) bool {
+			var list []ast.Stmt
+			switch n := n.(type) {
+			case *ast.BlockStmt:
+				list = n.List
+			case *ast.CaseClause:
+				list = n.Body
+			case *ast.CommClause:
+				list = n.Body
+			}
+
+			for i, stmt := range list {
+				sp.positions[stmt] = statementPosition{parent: n, index: i}
+			}
+
+			return true
+		})
+	}
+
+	position, ok := sp.positions[node]
+	return position, ok
+}
+
+// isNext nodeがprevの直後に並ぶ文か
+func (sp *statementPositions) isNext(prev, node ast.Node) bool {
+	prevPosition, ok := sp.get(prev)
+	if !ok {
+		return false
+	}
+
+	position, ok := sp.get(node)
+	if !ok {
+		return false
+	}
+
+	return position.parent == prevPosition.parent && position.index == prevPosition.index+1
+}
+
+/*
+statementRuns 全てのノード列で、同じ文の並びに連続して並ぶ2つ以上の文の根の位置を、
+ノード数の合計が閾値より大きいものだけ返す
+case節・select節は単位にならないので、その中に入って本体の文を根にする
+同じ文の並びの隣り合う文の間には他のノードがないので、隣り合う根が兄弟の文かどうかだけを見ればよい
+*/
+func (cd *CloneDetector) statementRuns(sequences [][]*domain.Node, positions *statementPositions) [][]int {
+	roots := splitSubtrees(sequences[0], -1, cd.areUnits(sequences))
+
+	isNext := func(prev, root int) bool {
+		for _, sequence := range sequences {
+			if !positions.isNext(sequence[prev].GetNode(), sequence[root].GetNode()) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	runs := [][]int{}
+	for start := 0; start < len(roots); {
+		end := start + 1
+		for end < len(roots) && isNext(roots[end-1], roots[end]) {
+			end++
+		}
+
+		if end-start >= 2 && runLength(sequences[0], roots[start:end]) > cd.config.Threshold {
+			runs = append(runs, roots[start:end])
+		}
+		start = end
+	}
+
+	return runs
+}
+
+// runLength 隣り合う部分木の根の位置から、それらのノード数の合計を求める
+func runLength(sequence []*domain.Node, roots []int) int {
+	first := roots[0]
+	return roots[len(roots)-1] - (first - int(sequence[first].GetChildCount())) + 1
+}
+
+// newStatementSequenceClonePair 連続して並ぶ文の根の位置から、それらをまとめたクローンを作る
+func (cd *CloneDetector) newStatementSequenceClonePair(sequence1, sequence2 []*domain.Node, run []int) *ClonePair {
+	roots1, roots2 := make([]*domain.Node, 0, len(run)), make([]*domain.Node, 0, len(run))
+	nodes1, nodes2 := make([]ast.Node, 0, len(run)), make([]ast.Node, 0, len(run))
+	for _, i := range run {
+		roots1 = append(roots1, sequence1[i])
+		roots2 = append(roots2, sequence2[i])
+		nodes1 = append(nodes1, sequence1[i].GetNode())
+		nodes2 = append(nodes2, sequence2[i].GetNode())
+	}
+
+	length := runLength(sequence1, run)
+	start := run[len(run)-1] - length + 1
+
+	return &ClonePair{
+		Fragment1:   newSequenceFragment(cd.fset, roots1, length),
+		Fragment2:   newSequenceFragment(cd.fset, roots2, length),
+		Fingerprint: fingerprint(sequence1[start : run[len(run)-1]+1]),
+		Type:        classifyCloneType(nodes1, nodes2),
+		Similarity:  1,
+	}
+}
@@ -0,0 +1,163 @@
+package clone_test
+
+import (
+	"context"
+	"errors"
+	"go/ast"
+	"path/filepath"
+	"testing"
+
+	clone "github.com/mazrean/go-clone-detection"
+)
+
+// 個々の文は閾値以下で、連続する3つの文を合わせると閾値を超える
+const sequenceSource1 = `package p
+
+func A(values []int) int {
+	println("a")
+	total := 0
+	count := len(values)
+	total += count * 2
+	return total
+}
+`
+
+const sequenceSource2 = `package p
+
+func B(items []int) int {
+	n := 0
+	count := len(items)
+	n += count * 2
+	println("b")
+	return n
+}
+`
+
+const sequenceSource3 = `package p
+
+func C(values []int) int {
+	if len(values) == 0 {
+		return 0
+	}
+	total := 0
+	count := len(values)
+	total += count * 2
+	return total
+}
+`
+
+var sequenceConfig = clone.Config{Threshold: 10, Granularity: clone.GranularityStatementSequence}
+
+// assertStatementSequence fragmentがstartLine行目からendLine行目までの3つの文を覆うか
+func assertStatementSequence(t *testing.T, fragment *clone.Fragment, startLine, endLine int) {
+	t.Helper()
+
+	if fragment.StartLine != startLine || fragment.EndLine != endLine || len(fragment.Nodes) != 3 {
+		t.Errorf("fragment does not cover the statement sequence: %s (%d statements)", fragment, len(fragment.Nodes))
+	}
+}
+
+func TestStatementSequenceClones(t *testing.T) {
+	cd := newSourceDetector(t, sequenceConfig,
+		source{"a.go", sequenceSource1},
+		source{"b.go", sequenceSource2},
+	)
+	clonePairs := getClones(t, cd)
+
+	clonePair := findClone(clonePairs, "a.go", 5, "b.go", 4)
+	if clonePair == nil {
+		t.Fatalf("clone of statement sequence not found: %v", clonePairStrings(clonePairs))
+	}
+	assertStatementSequence(t, clonePair.Fragment1, 5, 7)
+	assertStatementSequence(t, clonePair.Fragment2, 4, 6)
+	if clonePair.Node1 != nil || clonePair.Node2 != nil {
+		t.Error("clone of statement sequence has single roots")
+	}
+}
+
+func TestStatementSequenceCloneClasses(t *testing.T) {
+	cd := newSourceDetector(t, sequenceConfig,
+		source{"a.go", sequenceSource1},
+		source{"b.go", sequenceSource2},
+		source{"c.go", sequenceSource3},
+	)
+
+	cloneClasses, err := cd.GetCloneClasses()
+	if err != nil {
+		t.Fatalf("failed to get clone classes: %v", err)
+	}
+
+	// GetClonesと同じく、3つの文を1つのコード片にまとめる
+	var found *clone.CloneClass
+	for _, cloneClass := range cloneClasses {
+		if len(cloneClass.Fragments) == 3 && cloneClass.Fragments[0].Filename == "a.go" && cloneClass.Fragments[0].StartLine == 5 {
+			found = cloneClass
+		}
+	}
+	if found == nil {
+		t.Fatalf("clone class of statement sequence not found: %v", cloneClassStrings(cloneClasses))
+	}
+	assertStatementSequence(t, found.Fragments[0], 5, 7)
+	assertStatementSequence(t, found.Fragments[1], 4, 6)
+	assertStatementSequence(t, found.Fragments[2], 7, 9)
+	if found.TokenCount != 13 {
+		t.Errorf("unexpected token count: %d", found.TokenCount)
+	}
+
+	// 単一の部分木ではないので、関数にまとめることはできない
+	_, err = cd.FixCloneClass(found)
+	if !errors.Is(err, clone.ErrNotExtractable) {
+		t.Errorf("unexpected error fixing a statement sequence: %v", err)
+	}
+}
+
+func TestStatementSequenceAddFiles(t *testing.T) {
+	cd, dir := newFileDetector(t, sequenceConfig,
+		source{"a.go", sequenceSource1},
+		source{"b.go", joinSource},
+	)
+	if clonePairs := getClones(t, cd); len(clonePairs) != 0 {
+		t.Fatalf("unexpected clones: %v", clonePairStrings(clonePairs))
+	}
+
+	// 置き換えたファイルの文の並びも分かる
+	filename := filepath.Join(dir, "b.go")
+	err := cd.ReplaceFile(context.Background(), parseSource(t, cd, source{filename, sequenceSource2}))
+	if err != nil {
+		t.Fatalf("failed to replace file: %v", err)
+	}
+
+	clonePairs := getClones(t, cd)
+	clonePair := findClone(clonePairs, filepath.Join(dir, "a.go"), 5, filename, 4)
+	if clonePair == nil {
+		t.Fatalf("clone of statement sequence not found: %v", clonePairStrings(clonePairs))
+	}
+	assertStatementSequence(t, clonePair.Fragment1, 5, 7)
+}
+
+func TestStatementSequenceFileRequired(t *testing.T) {
+	cd := newSourceDetector(t, sequenceConfig, source{"a.go", sequenceSource1})
+	file := parseSource(t, cd, source{"b.go", sequenceSource2})
+
+	// ファイル全体でなければ文の並びが分からない
+	err := cd.AddNode(context.Background(), file.Decls[0])
+	if !errors.Is(err, clone.ErrFileRequired) {
+		t.Errorf("unexpected error adding a declaration: %v", err)
+	}
+
+	err = cd.AddNodes(context.Background(), []ast.Node{file, file.Decls[0]})
+	if !errors.Is(err, clone.ErrFileRequired) {
+		t.Errorf("unexpected error adding a declaration: %v", err)
+	}
+
+	// 置き換えられない場合は元のファイルが残る
+	file = parseSource(t, cd, source{"a.go", sequenceSource1})
+	err = cd.ReplaceFile(context.Background(), file.Decls[0])
+	if !errors.Is(err, clone.ErrFileRequired) {
+		t.Errorf("unexpected error replacing a file with a declaration: %v", err)
+	}
+	err = cd.RemoveFile("a.go")
+	if err != nil {
+		t.Errorf("file is removed by a failed replacement: %v", err)
+	}
+}
@@ -0,0 +1,110 @@
+package stree
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/mazrean/go-clone-detection/domain"
+)
+
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+)
+
+// document 接尾辞木に追加された入力1つ分
+type document struct {
+	id int
+	// domainNodes上の先頭の位置
+	start   int64
+	removed bool
+}
+
+func newDocument(id int, start int64) *document {
+	return &document{
+		id:    id,
+		start: start,
+	}
+}
+
+// getDocument domainNodes上の位置を含む入力
+func (st *STree) getDocument(index int) *document {
+	i := sort.Search(len(st.documents), func(i int) bool {
+		return st.documents[i].start > int64(index)
+	})
+
+	return st.documents[i-1]
+}
+
+// getDocumentEnd 入力の末尾(番兵ノードを含む)の次のdomainNodes上の位置
+func (st *STree) getDocumentEnd(i int) int64 {
+	if i+1 < len(st.documents) {
+		return st.documents[i+1].start
+	}
+
+	return int64(len(st.domainNodes))
+}
+
+/*
+RemoveDocument 終端済みの入力を削除する
+接尾辞木からは取り除かず削除済みとして印を付け、クローンの検出時に無視する
+削除済みのノードが全体の半分を超えた場合は、残っている入力から接尾辞木を作り直す
+*/
+func (st *STree) RemoveDocument(id int) error {
+	// 最後の要素は終端前の入力なので削除できない
+	i := sort.Search(len(st.documents)-1, func(i int) bool {
+		return st.documents[i].id >= id
+	})
+	if i == len(st.documents)-1 || st.documents[i].id != id || st.documents[i].removed {
+		return ErrDocumentNotFound
+	}
+
+	st.documents[i].removed = true
+	st.removedNodeNum += st.getDocumentEnd(i) - st.documents[i].start
+
+	// 終端前の入力があると作り直しで入力の途中の状態を失うので、次の機会に回す
+	if st.removedNodeNum*2 > int64(len(st.domainNodes)) && st.getDocumentEnd(len(st.documents)-1) == st.documents[len(st.documents)-1].start {
+		err := st.rebuild()
+		if err != nil {
+			return fmt.Errorf("error rebuilding suffix tree: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// rebuild 削除済みでない入力のみから接尾辞木を作り直す(入力のインデックスは変えない)
+func (st *STree) rebuild() error {
+	oldDomainNodes := st.domainNodes
+	oldDocuments := st.documents
+
+	st.domainNodes = make([]*domain.Node, 0, int64(len(oldDomainNodes))-st.removedNodeNum)
+	st.documents = []*document{}
+	st.removedNodeNum = 0
+	st.root = newRootNode(st)
+	st.leafNum = 0
+	st.latestNode = st.root
+	st.latestNodeLen = 0
+	st.nextNode = nil
+
+	for i, oldDocument := range oldDocuments[:len(oldDocuments)-1] {
+		if oldDocument.removed {
+			continue
+		}
+
+		st.documents = append(st.documents, newDocument(oldDocument.id, int64(len(st.domainNodes))))
+
+		// 番兵ノードも含めてそのまま追加し直す
+		end := oldDocuments[i+1].start
+		for _, domainNode := range oldDomainNodes[oldDocument.start:end] {
+			err := st.AddNode(domainNode)
+			if err != nil {
+				return fmt.Errorf("error adding node: %w", err)
+			}
+		}
+	}
+
+	st.documents = append(st.documents, newDocument(oldDocuments[len(oldDocuments)-1].id, int64(len(st.domainNodes))))
+
+	return nil
+}
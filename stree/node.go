@@ -69,21 +69,10 @@ func (n *node) getEdgeByLabel(domainNode *domain.Node) (*edge, error) {
 	}
 
 	id := sort.Search(len(n.edges), func(i int) bool {
-		if n.tree.domainNodes[n.edges[i].label.start].GetNodeType() == domainNode.GetNodeType() {
-			if n.tree.domainNodes[n.edges[i].label.start].GetToken() == domainNode.GetToken() {
-				return n.tree.domainNodes[n.edges[i].label.start].GetChildCount() >= domainNode.GetChildCount()
-			}
-
-			return n.tree.domainNodes[n.edges[i].label.start].GetToken() >= domainNode.GetToken()
-		}
-
-		return n.tree.domainNodes[n.edges[i].label.start].GetNodeType() >= domainNode.GetNodeType()
+		return compareNodes(n.tree.domainNodes[n.edges[i].label.start], domainNode) >= 0
 	})
 
-	if id == len(n.edges) ||
-		n.tree.domainNodes[n.edges[id].label.start].GetNodeType() != domainNode.GetNodeType() ||
-		n.tree.domainNodes[n.edges[id].label.start].GetToken() != domainNode.GetToken() ||
-		n.tree.domainNodes[n.edges[id].label.start].GetChildCount() != domainNode.GetChildCount() {
+	if id == len(n.edges) || !isSameNode(n.tree.domainNodes[n.edges[id].label.start], domainNode) {
 		return nil, ErrNoEdgeFound
 	}
 
@@ -98,15 +87,7 @@ func (n *node) addEdge(e *edge) error {
 	n.edges = append(n.edges, e)
 
 	sort.Slice(n.edges, func(i, j int) bool {
-		if n.tree.domainNodes[n.edges[i].label.start].GetNodeType() == n.tree.domainNodes[n.edges[j].label.start].GetNodeType() {
-			if n.tree.domainNodes[n.edges[i].label.start].GetToken() == n.tree.domainNodes[n.edges[j].label.start].GetToken() {
-				return n.tree.domainNodes[n.edges[i].label.start].GetChildCount() < n.tree.domainNodes[n.edges[j].label.start].GetChildCount()
-			}
-
-			return n.tree.domainNodes[n.edges[i].label.start].GetToken() < n.tree.domainNodes[n.edges[j].label.start].GetToken()
-		}
-
-		return n.tree.domainNodes[n.edges[i].label.start].GetNodeType() < n.tree.domainNodes[n.edges[j].label.start].GetNodeType()
+		return compareNodes(n.tree.domainNodes[n.edges[i].label.start], n.tree.domainNodes[n.edges[j].label.start]) < 0
 	})
 
 	return nil
@@ -0,0 +1,422 @@
+package stree
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/domain/values"
+)
+
+// FormatVersion Saveで書き出す形式のバージョン(互換性のない変更をしたときに上げる)
+const FormatVersion = 1
+
+var formatMagic = []byte("GCDSTREE")
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported suffix tree format")
+	ErrDocumentNotClosed = errors.New("document not closed")
+	ErrCorruptedFormat   = errors.New("corrupted suffix tree")
+)
+
+/*
+Save ノード列と接尾辞木の構造(ノード、エッジ、suffix link)をそのまま書き出す
+Loadでは接尾辞木を作り直さずに復元するので、入力の大きさに比例した読み込みだけで済む
+削除済みの入力も、次に作り直すまでは接尾辞木に残っているのでそのまま書き出す
+ノードのASTは書き出さないので、Loadした入力のノードはGetNodeがnilを返す
+*/
+func (st *STree) Save(w io.Writer) error {
+	current := st.documents[len(st.documents)-1]
+	if current.start != int64(len(st.domainNodes)) {
+		return ErrDocumentNotClosed
+	}
+
+	bw := bufio.NewWriter(w)
+	enc := &encoder{w: bw}
+
+	enc.writeBytes(formatMagic)
+	enc.writeUvarint(FormatVersion)
+
+	enc.writeUvarint(uint64(len(st.domainNodes)))
+	for _, domainNode := range st.domainNodes {
+		enc.writeNode(domainNode)
+	}
+
+	enc.writeUvarint(uint64(len(st.documents)))
+	for _, document := range st.documents {
+		enc.writeVarint(int64(document.id))
+		enc.writeUvarint(uint64(document.start))
+		enc.writeBool(document.removed)
+	}
+	enc.writeUvarint(uint64(st.removedNodeNum))
+
+	// 親より後ろになるよう幅優先順に番号を付ける(Loadで循環を検出できる)
+	nodes := []*node{st.root}
+	nodeIDs := map[*node]int{st.root: 0}
+	for i := 0; i < len(nodes); i++ {
+		for _, e := range nodes[i].edges {
+			nodeIDs[e.node] = len(nodes)
+			nodes = append(nodes, e.node)
+		}
+	}
+
+	enc.writeUvarint(uint64(len(nodes)))
+	for _, nd := range nodes {
+		enc.writeBytes([]byte{byte(nd.nodeType)})
+		if nd.nodeType == leafNodeType {
+			enc.writeUvarint(uint64(nd.value.Int64))
+			continue
+		}
+
+		suffixLink := int64(-1)
+		if nd.suffixLink != nil {
+			id, ok := nodeIDs[nd.suffixLink]
+			if !ok {
+				return fmt.Errorf("%w: suffix link to a node not in the tree", ErrCorruptedFormat)
+			}
+			suffixLink = int64(id)
+		}
+		enc.writeVarint(suffixLink)
+
+		enc.writeUvarint(uint64(len(nd.edges)))
+		for _, e := range nd.edges {
+			enc.writeUvarint(uint64(e.label.start))
+			end := int64(-1)
+			if e.label.end != finalIndex {
+				end = e.label.end
+			}
+			enc.writeVarint(end)
+			enc.writeUvarint(uint64(nodeIDs[e.node]))
+		}
+	}
+
+	// 次のノードを追加するときに使う、Ukkonenのアルゴリズムの状態
+	latestNode, ok := nodeIDs[st.latestNode]
+	if !ok {
+		return fmt.Errorf("%w: latest node not in the tree", ErrCorruptedFormat)
+	}
+	enc.writeUvarint(uint64(latestNode))
+	enc.writeUvarint(uint64(st.latestNodeLen))
+	enc.writeUvarint(uint64(st.leafNum))
+
+	if enc.err != nil {
+		return fmt.Errorf("error writing suffix tree: %w", enc.err)
+	}
+
+	err := bw.Flush()
+	if err != nil {
+		return fmt.Errorf("error writing suffix tree: %w", err)
+	}
+
+	return nil
+}
+
+/*
+Load Saveで書き出した接尾辞木を復元する
+入力のインデックスは書き出す前と同じになり、続けてノードを追加できる
+rがio.ByteReaderを実装していない場合は、書き出した分より先まで読み込むことがある
+壊れた入力に対してはErrCorruptedFormatを返す
+*/
+func Load(r io.Reader) (*STree, error) {
+	br, ok := r.(io.ByteReader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	dec := &decoder{r: br}
+
+	magic := dec.readBytes(len(formatMagic))
+	if dec.err == nil && string(magic) != string(formatMagic) {
+		return nil, ErrUnsupportedFormat
+	}
+
+	version := dec.readUvarint()
+	if dec.err == nil && version != FormatVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrUnsupportedFormat, version)
+	}
+
+	st := NewSTree()
+
+	domainNodeNum := dec.readCount()
+	for i := 0; i < domainNodeNum && dec.err == nil; i++ {
+		st.domainNodes = append(st.domainNodes, dec.readNode())
+	}
+
+	documentNum := dec.readCount()
+	st.documents = []*document{}
+	for i := 0; i < documentNum && dec.err == nil; i++ {
+		id := int(dec.readVarint())
+		start := int64(dec.readUvarint())
+		removed := dec.readBool()
+		if dec.err != nil {
+			break
+		}
+
+		if start > int64(len(st.domainNodes)) || (i > 0 && (start < st.documents[i-1].start || id <= st.documents[i-1].id)) {
+			return nil, fmt.Errorf("%w: invalid document %d", ErrCorruptedFormat, id)
+		}
+
+		document := newDocument(id, start)
+		document.removed = removed
+		st.documents = append(st.documents, document)
+	}
+	st.removedNodeNum = int64(dec.readUvarint())
+	if dec.err != nil {
+		return nil, fmt.Errorf("error reading suffix tree: %w", dec.err)
+	}
+
+	if len(st.documents) == 0 || st.documents[0].start != 0 || st.documents[len(st.documents)-1].start != int64(len(st.domainNodes)) {
+		return nil, fmt.Errorf("%w: documents do not cover the nodes", ErrCorruptedFormat)
+	}
+
+	err := st.readTree(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	return st, nil
+}
+
+// readTree Saveで書き出した接尾辞木の構造とUkkonenのアルゴリズムの状態を読み込む
+func (st *STree) readTree(dec *decoder) error {
+	nodeNum := dec.readCount()
+	if dec.err != nil {
+		return fmt.Errorf("error reading suffix tree: %w", dec.err)
+	}
+	// 接尾辞木のノード数はノード列の長さの2倍に根を加えた数を超えない
+	if nodeNum == 0 || nodeNum > 2*len(st.domainNodes)+1 {
+		return fmt.Errorf("%w: invalid number of nodes(%d)", ErrCorruptedFormat, nodeNum)
+	}
+
+	nodes := make([]*node, nodeNum)
+	for i := range nodes {
+		nodes[i] = &node{tree: st}
+	}
+	hasParent := make([]bool, nodeNum)
+
+	for i, nd := range nodes {
+		nd.nodeType = nodeType(dec.readByte())
+		if dec.err != nil {
+			return fmt.Errorf("error reading suffix tree: %w", dec.err)
+		}
+
+		if (i == 0) != (nd.nodeType == rootNodeType) {
+			return fmt.Errorf("%w: invalid type of node %d", ErrCorruptedFormat, i)
+		}
+
+		switch nd.nodeType {
+		case leafNodeType:
+			value := dec.readUvarint()
+			if dec.err == nil && value >= uint64(len(st.domainNodes)) {
+				return fmt.Errorf("%w: invalid leaf %d", ErrCorruptedFormat, i)
+			}
+			nd.value = sql.NullInt64{Int64: int64(value), Valid: true}
+
+			continue
+		case rootNodeType, internalNodeType:
+		default:
+			return fmt.Errorf("%w: invalid type of node %d", ErrCorruptedFormat, i)
+		}
+
+		suffixLink := dec.readVarint()
+		if dec.err == nil && (suffixLink < -1 || suffixLink >= int64(nodeNum)) {
+			return fmt.Errorf("%w: invalid suffix link of node %d", ErrCorruptedFormat, i)
+		}
+		if suffixLink >= 0 {
+			nd.suffixLink = nodes[suffixLink]
+		}
+
+		edgeNum := dec.readCount()
+		nd.edges = []*edge{}
+		for j := 0; j < edgeNum && dec.err == nil; j++ {
+			start := int64(dec.readUvarint())
+			end := dec.readVarint()
+			child := dec.readUvarint()
+			if dec.err != nil {
+				break
+			}
+
+			if end == -1 {
+				end = finalIndex
+			}
+			l, err := newLabel(start, end)
+			if err != nil || start >= int64(len(st.domainNodes)) || (end != finalIndex && end > int64(len(st.domainNodes))) {
+				return fmt.Errorf("%w: invalid label of node %d", ErrCorruptedFormat, i)
+			}
+
+			// 子は親より後ろにあり、親は1つだけなので木になる
+			if child <= uint64(i) || child >= uint64(nodeNum) || hasParent[child] {
+				return fmt.Errorf("%w: invalid edge of node %d", ErrCorruptedFormat, i)
+			}
+			hasParent[child] = true
+
+			nd.edges = append(nd.edges, newEdge(st, l, nodes[child]))
+		}
+	}
+
+	latestNode := dec.readUvarint()
+	st.latestNodeLen = int64(dec.readUvarint())
+	st.leafNum = int64(dec.readUvarint())
+	if dec.err != nil {
+		return fmt.Errorf("error reading suffix tree: %w", dec.err)
+	}
+
+	for i := 1; i < nodeNum; i++ {
+		if !hasParent[i] {
+			return fmt.Errorf("%w: node %d is not in the tree", ErrCorruptedFormat, i)
+		}
+	}
+
+	// Saveは入力を終端した後でしか書き出さないので、次の入力は根から始まる
+	if latestNode != 0 || st.latestNodeLen != 0 || st.leafNum != int64(len(st.domainNodes)) {
+		return fmt.Errorf("%w: invalid state", ErrCorruptedFormat)
+	}
+
+	st.root = nodes[0]
+	st.latestNode = nodes[latestNode]
+	st.nextNode = nil
+
+	return nil
+}
+
+// encoder 最初に起きたエラーを保持し、以降の書き込みを行わないwriter
+type encoder struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (e *encoder) writeBytes(b []byte) {
+	if e.err != nil {
+		return
+	}
+
+	_, e.err = e.w.Write(b)
+}
+
+func (e *encoder) writeUvarint(v uint64) {
+	n := binary.PutUvarint(e.buf[:], v)
+	e.writeBytes(e.buf[:n])
+}
+
+func (e *encoder) writeVarint(v int64) {
+	n := binary.PutVarint(e.buf[:], v)
+	e.writeBytes(e.buf[:n])
+}
+
+func (e *encoder) writeBool(v bool) {
+	if v {
+		e.writeBytes([]byte{1})
+	} else {
+		e.writeBytes([]byte{0})
+	}
+}
+
+func (e *encoder) writeNode(domainNode *domain.Node) {
+	if domainNode.IsTerminal() {
+		// 番兵ノードは入力のインデックスだけを持つ
+		e.writeBytes([]byte{byte(domainNode.GetNodeType())})
+		e.writeVarint(int64(domainNode.GetChildCount()))
+		return
+	}
+
+	e.writeBytes([]byte{byte(domainNode.GetNodeType()), byte(domainNode.GetToken())})
+	e.writeVarint(int64(domainNode.GetChildCount()))
+	e.writeUvarint(uint64(domainNode.GetValue()))
+	// 終了位置は開始位置との差分で書き出す
+	e.writeVarint(domainNode.GetPosition().GetStart())
+	e.writeVarint(domainNode.GetPosition().GetEnd() - domainNode.GetPosition().GetStart())
+}
+
+// maxCount 読み込む要素数の上限
+const maxCount = math.MaxInt32
+
+// decoder 最初に起きたエラーを保持し、以降の読み込みを行わないreader
+type decoder struct {
+	r   io.ByteReader
+	err error
+}
+
+func (d *decoder) readByte() byte {
+	if d.err != nil {
+		return 0
+	}
+
+	var b byte
+	b, d.err = d.r.ReadByte()
+	if errors.Is(d.err, io.EOF) {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return b
+}
+
+func (d *decoder) readBytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = d.readByte()
+	}
+
+	return b
+}
+
+func (d *decoder) readUvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+
+	var v uint64
+	v, d.err = binary.ReadUvarint(d.r)
+	if errors.Is(d.err, io.EOF) {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return v
+}
+
+func (d *decoder) readVarint() int64 {
+	if d.err != nil {
+		return 0
+	}
+
+	var v int64
+	v, d.err = binary.ReadVarint(d.r)
+	if errors.Is(d.err, io.EOF) {
+		d.err = io.ErrUnexpectedEOF
+	}
+
+	return v
+}
+
+func (d *decoder) readBool() bool {
+	return d.readByte() != 0
+}
+
+// readCount 要素数を読み込む(intに収まらない値はエラーにする)
+func (d *decoder) readCount() int {
+	count := d.readUvarint()
+	if d.err == nil && count > maxCount {
+		d.err = fmt.Errorf("%w: too many elements(%d)", ErrCorruptedFormat, count)
+	}
+
+	return int(count)
+}
+
+func (d *decoder) readNode() *domain.Node {
+	nodeType := values.NodeType(d.readByte())
+	if nodeType == values.NodeTypeTerminal {
+		return domain.NewTerminalNode(int(d.readVarint()))
+	}
+
+	nodeToken := values.NodeToken(d.readByte())
+	childCount := values.NewChildCount(d.readVarint())
+	value := values.NodeValue(d.readUvarint())
+	start := d.readVarint()
+	end := start + d.readVarint()
+
+	return domain.NewNode(nil, nodeType, values.NewPosition(start, end), childCount, nodeToken, value)
+}
@@ -0,0 +1,311 @@
+package stree_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"testing"
+
+	"github.com/mazrean/go-clone-detection/domain"
+	"github.com/mazrean/go-clone-detection/serializer"
+	"github.com/mazrean/go-clone-detection/stree"
+)
+
+var sources = []string{
+	`package p
+
+func sum(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+	return total
+}
+`,
+	`package p
+
+func count(items []int) int {
+	n := 0
+	for _, item := range items {
+		if item > 0 {
+			n += item
+		}
+	}
+	return n
+}
+`,
+	`package p
+
+func join(parts []string, sep string) string {
+	result := ""
+	for _, part := range parts {
+		if part != "" {
+			result += sep + part
+		}
+	}
+	return result
+}
+`,
+}
+
+func serialize(t *testing.T, src string) []*domain.Node {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "p.go", src, 0)
+	if err != nil {
+		t.Fatalf("failed to parse source: %v", err)
+	}
+
+	nodeChan := make(chan *domain.Node)
+	go func() {
+		defer close(nodeChan)
+		_ = serializer.NewSerializer(0).Serialize(context.Background(), file, nodeChan)
+	}()
+
+	nodes := []*domain.Node{}
+	for node := range nodeChan {
+		nodes = append(nodes, node)
+	}
+
+	return nodes
+}
+
+func addDocument(t *testing.T, st *stree.STree, nodes []*domain.Node) int {
+	t.Helper()
+
+	for _, node := range nodes {
+		err := st.AddNode(node)
+		if err != nil {
+			t.Fatalf("failed to add node: %v", err)
+		}
+	}
+
+	document, err := st.CloseDocument()
+	if err != nil {
+		t.Fatalf("failed to close document: %v", err)
+	}
+
+	return document
+}
+
+func saveAndLoad(t *testing.T, st *stree.STree) *stree.STree {
+	t.Helper()
+
+	var buf bytes.Buffer
+	err := st.Save(&buf)
+	if err != nil {
+		t.Fatalf("failed to save suffix tree: %v", err)
+	}
+
+	loaded, err := stree.Load(&buf)
+	if err != nil {
+		t.Fatalf("failed to load suffix tree: %v", err)
+	}
+
+	return loaded
+}
+
+// cloneKeys 読み込んだノードはポインタが変わるので、入力・位置・長さとノードの内容で比べる
+func cloneKeys(t *testing.T, st *stree.STree) []string {
+	t.Helper()
+
+	clonePairs, err := st.GetClonePairs(5)
+	if err != nil {
+		t.Fatalf("failed to get clone pairs: %v", err)
+	}
+
+	keys := []string{}
+	for _, clonePair := range clonePairs {
+		sequence1, sequence2 := clonePair.GetSequences()
+		keys = append(keys, fmt.Sprintf("%s %s", sequenceKey(sequence1), sequenceKey(sequence2)))
+	}
+
+	cloneClasses, err := st.GetCloneClasses(5)
+	if err != nil {
+		t.Fatalf("failed to get clone classes: %v", err)
+	}
+
+	for _, cloneClass := range cloneClasses {
+		key := "class"
+		for _, sequence := range cloneClass.GetSequences() {
+			key += " " + sequenceKey(sequence)
+		}
+		keys = append(keys, key)
+	}
+
+	return keys
+}
+
+func sequenceKey(sequence *domain.CloneSequence) string {
+	nodes := sequence.GetNodes()
+	first, last := nodes[0], nodes[len(nodes)-1]
+
+	return fmt.Sprintf("%d:%d:%d:%d-%d", sequence.GetDocument(), sequence.GetIndex(), len(nodes), first.GetPosition().GetStart(), last.GetPosition().GetEnd())
+}
+
+func assertSameKeys(t *testing.T, expected, actual []string) {
+	t.Helper()
+
+	if len(expected) == 0 {
+		t.Fatal("no clones found")
+	}
+
+	if len(expected) != len(actual) {
+		t.Fatalf("number of clones differs: expected %d, actual %d", len(expected), len(actual))
+	}
+
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("clone %d differs:\nexpected %s\nactual   %s", i, expected[i], actual[i])
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	st := stree.NewSTree()
+	for _, src := range sources {
+		addDocument(t, st, serialize(t, src))
+	}
+
+	loaded := saveAndLoad(t, st)
+	assertSameKeys(t, cloneKeys(t, st), cloneKeys(t, loaded))
+
+	// 読み込んだ接尾辞木にも続けて追加でき、追加し続けたものと同じになる
+	nodes := serialize(t, sources[0])
+	document := addDocument(t, st, nodes)
+	loadedDocument := addDocument(t, loaded, nodes)
+	if document != loadedDocument {
+		t.Errorf("document index differs: expected %d, actual %d", document, loadedDocument)
+	}
+	assertSameKeys(t, cloneKeys(t, st), cloneKeys(t, loaded))
+}
+
+func TestSaveLoadRemovedDocument(t *testing.T) {
+	st := stree.NewSTree()
+	for _, src := range append(sources, sources[0]) {
+		addDocument(t, st, serialize(t, src))
+	}
+
+	err := st.RemoveDocument(1)
+	if err != nil {
+		t.Fatalf("failed to remove document: %v", err)
+	}
+
+	loaded := saveAndLoad(t, st)
+	assertSameKeys(t, cloneKeys(t, st), cloneKeys(t, loaded))
+
+	// 削除済みの入力は読み込んだ後も削除済みのまま
+	err = loaded.RemoveDocument(1)
+	if !errors.Is(err, stree.ErrDocumentNotFound) {
+		t.Errorf("unexpected error removing a removed document: %v", err)
+	}
+
+	// 読み込んだ後の削除で作り直しても同じになる
+	for _, tree := range []*stree.STree{st, loaded} {
+		err := tree.RemoveDocument(2)
+		if err != nil {
+			t.Fatalf("failed to remove document: %v", err)
+		}
+	}
+	assertSameKeys(t, cloneKeys(t, st), cloneKeys(t, loaded))
+}
+
+func TestSaveDocumentNotClosed(t *testing.T) {
+	st := stree.NewSTree()
+	for _, node := range serialize(t, sources[0]) {
+		err := st.AddNode(node)
+		if err != nil {
+			t.Fatalf("failed to add node: %v", err)
+		}
+	}
+
+	err := st.Save(&bytes.Buffer{})
+	if !errors.Is(err, stree.ErrDocumentNotClosed) {
+		t.Errorf("unexpected error saving an open document: %v", err)
+	}
+}
+
+func TestLoadCorrupted(t *testing.T) {
+	st := stree.NewSTree()
+	for _, src := range sources {
+		addDocument(t, st, serialize(t, src))
+	}
+
+	var buf bytes.Buffer
+	err := st.Save(&buf)
+	if err != nil {
+		t.Fatalf("failed to save suffix tree: %v", err)
+	}
+	data := buf.Bytes()
+
+	// 途中で切れた入力はエラーになる
+	for _, length := range []int{0, 4, len(data) / 3, len(data) / 2, len(data) - 1} {
+		_, err := stree.Load(bytes.NewReader(data[:length]))
+		if err == nil {
+			t.Errorf("no error loading data truncated to %d bytes", length)
+		}
+	}
+
+	// 書き換えられた入力でもpanicしない
+	for i := len("GCDSTREE"); i < len(data); i++ {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] ^= 0xff
+
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					t.Fatalf("panic loading data corrupted at byte %d: %v", i, r)
+				}
+			}()
+
+			_, _ = stree.Load(bytes.NewReader(corrupted))
+		}()
+	}
+
+	_, err = stree.Load(bytes.NewReader([]byte("GCDSTREE\x02")))
+	if !errors.Is(err, stree.ErrUnsupportedFormat) {
+		t.Errorf("unexpected error loading an unknown version: %v", err)
+	}
+}
+
+func TestLoadInvalidState(t *testing.T) {
+	st := stree.NewSTree()
+	for _, src := range sources {
+		addDocument(t, st, serialize(t, src))
+	}
+
+	var buf bytes.Buffer
+	err := st.Save(&buf)
+	if err != nil {
+		t.Fatalf("failed to save suffix tree: %v", err)
+	}
+	data := buf.Bytes()
+
+	// 末尾は最後に辿ったノード、その位置からの長さ、葉の数の順に並ぶ
+	leafNum := len(data) - 1
+	for data[leafNum-1]&0x80 != 0 {
+		leafNum--
+	}
+	latestNodeLen, latestNode := leafNum-1, leafNum-2
+	if data[latestNodeLen] != 0 || data[latestNode] != 0 {
+		t.Fatalf("saved suffix tree is not at the root: %d, %d", data[latestNode], data[latestNodeLen])
+	}
+
+	for name, i := range map[string]int{
+		"non-zero active length": latestNodeLen,
+		"non-root active node":   latestNode,
+	} {
+		corrupted := append([]byte{}, data...)
+		corrupted[i] = 1
+
+		_, err := stree.Load(bytes.NewReader(corrupted))
+		if !errors.Is(err, stree.ErrCorruptedFormat) {
+			t.Errorf("unexpected error loading a suffix tree with %s: %v", name, err)
+		}
+	}
+}
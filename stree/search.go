@@ -0,0 +1,104 @@
+package stree
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mazrean/go-clone-detection/domain"
+)
+
+/*
+FindMatches 入力中でqueryの一部と一致するノード列のうち、長さが閾値より大きいものを返す
+queryの各位置から根を辿れるところまで辿り、その下にあるleafを一致した位置とする
+直前のノードも一致するものは、queryの1つ前の位置からの一致に含まれるので除く
+*/
+func (st *STree) FindMatches(query []*domain.Node, threshold int) ([]*domain.SequenceMatch, error) {
+	matches := []*domain.SequenceMatch{}
+	for i := range query {
+		nd, length, err := st.match(query[i:])
+		if err != nil {
+			return nil, fmt.Errorf("error matching query: %w", err)
+		}
+
+		if length <= threshold {
+			continue
+		}
+
+		leafs, err := st.collectLeafs(nd)
+		if err != nil {
+			return nil, fmt.Errorf("error collecting leafs: %w", err)
+		}
+
+		for _, leaf := range leafs {
+			if i > 0 && leaf > 0 && isSameNode(query[i-1], st.domainNodes[leaf-1]) {
+				continue
+			}
+
+			matches = append(matches, domain.NewSequenceMatch(i, st.newCloneSequence(leaf, length)))
+		}
+	}
+
+	return matches, nil
+}
+
+/*
+match 根からqueryの先頭から一致する限り辿り、一致したノード数を返す
+辿り終えた位置がedgeの途中の場合は、そのedgeの先のノードを返す
+*/
+func (st *STree) match(query []*domain.Node) (*node, int, error) {
+	nd := st.root
+	length := 0
+	for length < len(query) {
+		e, err := nd.getEdgeByLabel(query[length])
+		if errors.Is(err, ErrNoEdgeFound) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("error getting edge: %w", err)
+		}
+
+		edgeLength := int(e.getLength())
+		start := int(e.getLabel().start)
+		// 先頭のノードはgetEdgeByLabelで一致を確かめている
+		j := 1
+		for j < edgeLength && length+j < len(query) && isSameNode(st.domainNodes[start+j], query[length+j]) {
+			j++
+		}
+
+		nd = e.getNode()
+		length += j
+		if j < edgeLength || nd.getNodeType() == leafNodeType {
+			break
+		}
+	}
+
+	return nd, length, nil
+}
+
+// collectLeafs ndを根とする部分木のうち、削除済みでない入力のleafの値を返す
+func (st *STree) collectLeafs(nd *node) ([]int, error) {
+	if nd.getNodeType() == leafNodeType {
+		ndValue, err := nd.getValue()
+		if err != nil {
+			return nil, fmt.Errorf("error getting value: %w", err)
+		}
+
+		if st.getDocument(int(ndValue)).removed {
+			return []int{}, nil
+		}
+
+		return []int{int(ndValue)}, nil
+	}
+
+	leafs := []int{}
+	for _, e := range nd.getEdges() {
+		newLeafs, err := st.collectLeafs(e.getNode())
+		if err != nil {
+			return nil, err
+		}
+
+		leafs = append(leafs, newLeafs...)
+	}
+
+	return leafs, nil
+}
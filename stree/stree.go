@@ -1,6 +1,7 @@
 package stree
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
@@ -8,18 +9,27 @@ import (
 	"github.com/mazrean/go-clone-detection/domain"
 )
 
+/*
+STree 一般化接尾辞木
+入力ごとに固有の番兵ノードを終端に置くので、クローンが入力の境界をまたぐことはない
+*/
 type STree struct {
-	domainNodes   []*domain.Node
-	root          *node
-	leafNum       int64
-	latestNode    *node
-	latestNodeLen int64
-	nextNode      *node
+	domainNodes []*domain.Node
+	// domainNodes上の位置の順に並んだ入力(最後の要素は終端前の入力)
+	documents []*document
+	// 削除済みの入力に含まれるノード数
+	removedNodeNum int64
+	root           *node
+	leafNum        int64
+	latestNode     *node
+	latestNodeLen  int64
+	nextNode       *node
 }
 
 func NewSTree() *STree {
 	tree := &STree{
 		domainNodes: []*domain.Node{},
+		documents:   []*document{newDocument(0, 0)},
 		leafNum:     0,
 	}
 
@@ -87,9 +97,7 @@ func (st *STree) AddNode(newDomainNode *domain.Node) error {
 
 		domainNode := st.domainNodes[e.getLabel().start+int64(len(restDomainNodes))-1]
 
-		if domainNode.GetNodeType() != newDomainNode.GetNodeType() ||
-			domainNode.GetToken() != newDomainNode.GetToken() ||
-			domainNode.GetChildCount() != newDomainNode.GetChildCount() {
+		if !isSameNode(domainNode, newDomainNode) {
 			// エッジがみつかり、次の文字が適合しない場合も、Rule2適用
 
 			splitPoint := e.getLabel().start + int64(len(restDomainNodes)) - 1
@@ -166,6 +174,20 @@ func (st *STree) AddNode(newDomainNode *domain.Node) error {
 	return nil
 }
 
+// CloseDocument 現在の入力に番兵ノードを追加して終端し、終端した入力のインデックスを返す
+func (st *STree) CloseDocument() (int, error) {
+	document := st.documents[len(st.documents)-1]
+
+	err := st.AddNode(domain.NewTerminalNode(document.id))
+	if err != nil {
+		return 0, fmt.Errorf("error adding terminal node: %w", err)
+	}
+
+	st.documents = append(st.documents, newDocument(document.id+1, int64(len(st.domainNodes))))
+
+	return document.id, nil
+}
+
 func (st *STree) walk(nd *node, domainNodes []*domain.Node) (*node, *edge, []*domain.Node, error) {
 	e, err := nd.getEdgeByLabel(domainNodes[0])
 	if errors.Is(err, ErrNoEdgeFound) {
@@ -190,10 +212,7 @@ func (st *STree) walk(nd *node, domainNodes []*domain.Node) (*node, *edge, []*do
 
 	edgeLastNode := st.domainNodes[e.getLabel().start+int64(len(domainNodes))-1]
 	restLastNode := domainNodes[len(domainNodes)-1]
-	if e.getLength() == int64(len(domainNodes)) &&
-		edgeLastNode.GetNodeType() == restLastNode.GetNodeType() &&
-		edgeLastNode.GetToken() == restLastNode.GetToken() &&
-		edgeLastNode.GetChildCount() == restLastNode.GetChildCount() {
+	if e.getLength() == int64(len(domainNodes)) && isSameNode(edgeLastNode, restLastNode) {
 		return e.getNode(), nil, domainNodes[e.getLength():], nil
 	}
 
@@ -201,22 +220,157 @@ func (st *STree) walk(nd *node, domainNodes []*domain.Node) (*node, *edge, []*do
 }
 
 func (st *STree) GetClonePairs(threshold int) ([]*domain.CloneSequencePair, error) {
+	var clonePairs []*domain.CloneSequencePair
+	err := st.EachClonePair(context.Background(), threshold, func(clonePair *domain.CloneSequencePair) error {
+		clonePairs = append(clonePairs, clonePair)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// 辿る順は接尾辞木の形に依存するので、位置の順に並べ替える
+	domain.SortCloneSequencePairs(clonePairs)
+
+	return clonePairs, nil
+}
+
+/*
+EachClonePair GetClonePairsと同じクローンの組を、接尾辞木を辿りながら見つけた順にyieldへ渡す
+yieldがエラーを返すかctxがキャンセルされた場合は、そこで辿るのをやめてそのエラーを返す
+*/
+func (st *STree) EachClonePair(ctx context.Context, threshold int, yield func(*domain.CloneSequencePair) error) error {
 	/*
 		考え方:
-		- 各クローンをクローンの終了位置で識別する
-		- startが大きいedgeのCloneにより長い(=startが小さい)Cloneがある場合上書き
-			- sortしてstartが大きいCloneから検出
-			- 被った場合上書き
-		- startが同じで長さがより長いCloneはsuffix treeの中で長い方のみ残るので、発生しない
+		- 2つのleafの最長共通接頭辞は、2つのleafの最も深い共通祖先の内部ノードまでのトークン数
+			- 異なる区分にあるleafの組は、その内部ノードより後ろには伸ばせない
+		- 直前のノードが一致する組は、より長いクローンの一部なので除く
+	*/
+
+	return st.walkInternalNodes(func(length int, leafsList [][]int) error {
+		err := ctx.Err()
+		if err != nil {
+			return err
+		}
+
+		if length <= threshold {
+			return nil
+		}
+
+		addPair := func(leaf1, leaf2 int) error {
+			if leaf1 > 0 && leaf2 > 0 && isSameNode(st.domainNodes[leaf1-1], st.domainNodes[leaf2-1]) {
+				return nil
+			}
+
+			return yield(domain.NewCloneSequencePair(
+				st.newCloneSequence(leaf1, length),
+				st.newCloneSequence(leaf2, length),
+			))
+		}
+
+		//各区分のleaf間のペア検出
+		for i, leafs := range leafsList {
+			//直下のleafは同じ区分内でもペアになる
+			if i == len(leafsList)-1 {
+				for j, leaf1 := range leafs {
+					for _, leaf2 := range leafs[j+1:] {
+						err := addPair(leaf1, leaf2)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+			for j := i + 1; j < len(leafsList); j++ {
+				for _, leaf1 := range leafs {
+					for _, leaf2 := range leafsList[j] {
+						err := addPair(leaf1, leaf2)
+						if err != nil {
+							return err
+						}
+					}
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (st *STree) GetCloneClasses(threshold int) ([]*domain.CloneClass, error) {
+	/*
+		内部ノード1つを1つのクローンクラスとする
+		直前のノードが全て一致する場合はより長いクローンクラスの一部なので除く
 	*/
 
+	var cloneClasses []*domain.CloneClass
+	err := st.walkInternalNodes(func(length int, leafsList [][]int) error {
+		if length <= threshold {
+			return nil
+		}
+
+		leafs := []int{}
+		for _, leafList := range leafsList {
+			leafs = append(leafs, leafList...)
+		}
+
+		if !st.isLeftDiverse(leafs) {
+			return nil
+		}
+
+		sort.Ints(leafs)
+
+		sequences := make([]*domain.CloneSequence, 0, len(leafs))
+		for _, leaf := range leafs {
+			sequences = append(sequences, st.newCloneSequence(leaf, length))
+		}
+
+		cloneClasses = append(cloneClasses, domain.NewCloneClass(sequences))
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	domain.SortCloneClasses(cloneClasses)
+
+	return cloneClasses, nil
+}
+
+func (st *STree) newCloneSequence(start int, length int) *domain.CloneSequence {
+	return domain.NewCloneSequence(st.getDocument(start).id, start, st.domainNodes[start:start+length])
+}
+
+func (st *STree) isLeftDiverse(leafs []int) bool {
+	var leftNode *domain.Node
+	for _, leaf := range leafs {
+		if leaf == 0 {
+			return true
+		}
+
+		if leftNode == nil {
+			leftNode = st.domainNodes[leaf-1]
+			continue
+		}
+
+		if !isSameNode(leftNode, st.domainNodes[leaf-1]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// walkInternalNodes 全ての内部ノードを帰りがけ順に訪れる
+func (st *STree) walkInternalNodes(visit func(length int, leafsList [][]int) error) error {
 	rootEdges := make([]*edge, len(st.root.getEdges()))
 	copy(rootEdges, st.root.getEdges())
 	sort.Slice(rootEdges, func(i, j int) bool {
 		return rootEdges[i].getLabel().start > rootEdges[j].getLabel().start
 	})
 
-	cloneMaps := map[int]map[int]int{}
 	for _, e := range rootEdges {
 		nd := e.getNode()
 		ndType := nd.getNodeType()
@@ -224,34 +378,28 @@ func (st *STree) GetClonePairs(threshold int) ([]*domain.CloneSequencePair, erro
 			continue
 		}
 
-		var err error
-		_, cloneMaps, err = st.dfs(nd, threshold, int(e.getLength()), cloneMaps)
+		_, err := st.dfs(nd, int(e.getLength()), visit)
 		if err != nil {
-			return nil, fmt.Errorf("error dfs: %w", err)
+			return fmt.Errorf("error dfs: %w", err)
 		}
 	}
 
-	var clonePairs []*domain.CloneSequencePair
-	for end1, cloneMap := range cloneMaps {
-		for end2, length := range cloneMap {
-			clonePairs = append(clonePairs, domain.NewCloneSequencePair(
-				st.domainNodes[end1-length:end1],
-				st.domainNodes[end2-length:end2],
-			))
-		}
-	}
-
-	return clonePairs, nil
+	return nil
 }
 
-func (st *STree) dfs(nd *node, threshold int, length int, cloneMap map[int]map[int]int) ([]int, map[int]map[int]int, error) {
+/*
+dfs ndを根とする部分木の内部ノードについてvisitを呼び、部分木内のleafの値を返す
+visitには根からのトークン数と、各区分(直下でない場合はedgeごと、直下の場合は直下のグループ)ごとのleafの値を渡す
+直下のグループは常に最後の区分になる
+*/
+func (st *STree) dfs(nd *node, length int, visit func(length int, leafsList [][]int) error) ([]int, error) {
 	if nd.getNodeType() != internalNodeType {
-		return nil, nil, errors.New("error dfs: not internal node")
+		return nil, errors.New("error dfs: not internal node")
 	}
 
 	//直下にあるleafの値
 	directLeafs := []int{}
-	//各区分(直下でない場合はedgeごと、直下の場合は直下のグループ)ごとのleafの値
+	//各区分ごとのleafの値
 	leafsList := [][]int{}
 	for _, e := range nd.getEdges() {
 		nd := e.getNode()
@@ -259,16 +407,19 @@ func (st *STree) dfs(nd *node, threshold int, length int, cloneMap map[int]map[i
 		if ndType == leafNodeType {
 			ndValue, err := nd.getValue()
 			if err != nil {
-				return nil, nil, fmt.Errorf("error getting value: %w", err)
+				return nil, fmt.Errorf("error getting value: %w", err)
+			}
+
+			// 削除済みの入力のleafは無いものとして扱う
+			if st.getDocument(int(ndValue)).removed {
+				continue
 			}
 
 			directLeafs = append(directLeafs, int(ndValue))
 		} else {
-			var newLeafs []int
-			var err error
-			newLeafs, cloneMap, err = st.dfs(nd, threshold, length+int(e.getLength()), cloneMap)
+			newLeafs, err := st.dfs(nd, length+int(e.getLength()), visit)
 			if err != nil {
-				return nil, nil, fmt.Errorf("error dfs: %w", err)
+				return nil, fmt.Errorf("error dfs: %w", err)
 			}
 
 			leafsList = append(leafsList, newLeafs)
@@ -277,32 +428,9 @@ func (st *STree) dfs(nd *node, threshold int, length int, cloneMap map[int]map[i
 
 	leafsList = append(leafsList, directLeafs)
 
-	if length > threshold {
-		//直下のleaf間のペア検出
-		for i, leaf1 := range directLeafs {
-			for j := i + 1; j < len(directLeafs); j++ {
-				_, ok := cloneMap[leaf1+length]
-				if !ok {
-					cloneMap[leaf1+length] = map[int]int{}
-				}
-				cloneMap[leaf1+length][directLeafs[j]+length] = length
-			}
-		}
-
-		//各区分のleaf間のペア検出
-		for i, leafs := range leafsList {
-			for j := i + 1; j < len(leafsList); j++ {
-				for _, leaf1 := range leafs {
-					for _, leaf2 := range leafsList[j] {
-						_, ok := cloneMap[leaf1+length]
-						if !ok {
-							cloneMap[leaf1+length] = map[int]int{}
-						}
-						cloneMap[leaf1+length][leaf2+length] = length
-					}
-				}
-			}
-		}
+	err := visit(length, leafsList)
+	if err != nil {
+		return nil, err
 	}
 
 	//子ノードにあるleafの値
@@ -311,5 +439,40 @@ func (st *STree) dfs(nd *node, threshold int, length int, cloneMap map[int]map[i
 		leafs = append(leafs, leafList...)
 	}
 
-	return leafs, cloneMap, nil
+	return leafs, nil
+}
+
+/*
+compareNodes ノードの種類、トークン、子の数、値の順に比較する
+node1が小さい場合は負、等しい場合は0、大きい場合は正の値を返す
+*/
+func compareNodes(node1, node2 *domain.Node) int {
+	switch {
+	case node1.GetNodeType() != node2.GetNodeType():
+		return compareUint64(uint64(node1.GetNodeType()), uint64(node2.GetNodeType()))
+	case node1.GetToken() != node2.GetToken():
+		return compareUint64(uint64(node1.GetToken()), uint64(node2.GetToken()))
+	case node1.GetChildCount() != node2.GetChildCount():
+		if node1.GetChildCount() < node2.GetChildCount() {
+			return -1
+		}
+		return 1
+	}
+
+	return compareUint64(uint64(node1.GetValue()), uint64(node2.GetValue()))
+}
+
+func compareUint64(value1, value2 uint64) int {
+	switch {
+	case value1 < value2:
+		return -1
+	case value1 > value2:
+		return 1
+	}
+
+	return 0
+}
+
+func isSameNode(node1, node2 *domain.Node) bool {
+	return compareNodes(node1, node2) == 0
 }
@@ -1,10 +1,24 @@
 package clone
 
 import (
+	"context"
+
 	"github.com/mazrean/go-clone-detection/domain"
 )
 
 type SuffixTree interface {
 	AddNode(node *domain.Node) error
+	// 現在の入力を終端し、その入力のインデックスを返す
+	CloseDocument() (int, error)
+	// 終端済みの入力を削除し、以降のクローン検出の対象から外す
+	RemoveDocument(document int) error
+	// 長さが閾値より大きいクローンの組を、domain.SortCloneSequencePairsの順に返す
 	GetClonePairs(threshold int) ([]*domain.CloneSequencePair, error)
+	// GetClonePairsと同じクローンの組を、見つけた順にyieldへ渡す(yieldのエラーやキャンセルで中断する)
+	// 同じ入力に対しては毎回同じ順になるが、位置の順には並ばない
+	EachClonePair(ctx context.Context, threshold int, yield func(*domain.CloneSequencePair) error) error
+	// 長さが閾値より大きいクローンクラスを、domain.SortCloneClassesの順に返す
+	GetCloneClasses(threshold int) ([]*domain.CloneClass, error)
+	// 入力中でqueryの一部と一致するノード列のうち、長さが閾値より大きいものを返す
+	FindMatches(query []*domain.Node, threshold int) ([]*domain.SequenceMatch, error)
 }
@@ -0,0 +1,34 @@
+package src
+
+func sumPositive(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+
+	return total
+}
+
+func sumNegative(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value < 0 {
+			total += value
+		}
+	}
+
+	return total
+}
+
+func countNonEmpty(items []string) int {
+	n := 0
+	for _, item := range items {
+		if item != "" {
+			n++
+		}
+	}
+
+	return n
+}
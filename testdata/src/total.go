@@ -0,0 +1,23 @@
+package src
+
+func totalPositive(values []int) int {
+	total := 0
+	for _, value := range values {
+		if value > 0 {
+			total += value
+		}
+	}
+
+	return total
+}
+
+func maxValue(values []int) int {
+	max := 0
+	for _, value := range values {
+		if value > max {
+			max = value
+		}
+	}
+
+	return max
+}
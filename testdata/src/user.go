@@ -0,0 +1,47 @@
+package src
+
+import "strings"
+
+type User struct {
+	Name  string
+	Email string
+	Age   int
+}
+
+func normalizeUsers(users []*User) []*User {
+	normalized := make([]*User, 0, len(users))
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+
+		normalized = append(normalized, &User{
+			Name:  strings.TrimSpace(user.Name),
+			Email: strings.ToLower(strings.TrimSpace(user.Email)),
+			Age:   user.Age,
+		})
+	}
+
+	return normalized
+}
+
+func adultUsers(users []*User) []*User {
+	adults := make([]*User, 0, len(users))
+	for _, user := range users {
+		if user == nil {
+			continue
+		}
+
+		if user.Age < 18 {
+			continue
+		}
+
+		adults = append(adults, &User{
+			Name:  strings.TrimSpace(user.Name),
+			Email: strings.ToLower(strings.TrimSpace(user.Email)),
+			Age:   user.Age,
+		})
+	}
+
+	return adults
+}